@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// archiveFlags registers the flags of the archive and watch commands besides
+// the download flags.
+func archiveFlags(fs *flag.FlagSet) {
+	fs.StringVar(&videoType, "type", "archive", "Type of the VODs: archive, highlight, upload or all. (optional)")
+	fs.IntVar(&limit, "limit", 0, "Maximum number of recent VODs to consider per channel. 0 considers every VOD. (optional)")
+	fs.StringVar(&archiveFile, "archive-file", "twitchdl-archive.txt", "Path to the file recording the IDs of the downloaded VODs. (optional)")
+	limitWindows = nil
+	fs.Var(windowsValue{&limitWindows}, "limit-window", "Time of day window with its own bandwidth limit overriding -limit-rate such as 22:00-07:00=0\nfor no limit at night. Can be repeated. (optional)")
+}
+
+func runArchive(args []string) error {
+	if len(args) == 0 {
+		return errors.New("archive expects at least one channel")
+	}
+	return archive(args)
+}
+
+func runWatch(args []string) error {
+	if len(args) == 0 {
+		return errors.New("watch expects at least one channel")
+	}
+	for {
+		if err := archive(args); err != nil {
+			log.Printf("%v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// archive downloads the VODs of the channels logins whose IDs are not
+// recorded in the archive file, oldest first, and records them.
+// VODs of streams still live are skipped until the stream ends.
+func archive(logins []string) error {
+	bt, err := broadcastType(videoType)
+	if err != nil {
+		return err
+	}
+	done, err := readArchive(archiveFile)
+	if err != nil {
+		return err
+	}
+	api := twitch.New(httpClient, defaultClientID)
+	defaults := batchDefaults()
+	defaults.progress = true
+	var failed int
+	for _, login := range logins {
+		vods, err := api.ChannelVideos(context.Background(), login, bt, limit)
+		if err != nil {
+			return errors.Wrapf(err, "Retrieving VODs of channel %s failed", login)
+		}
+		for i := len(vods) - 1; i >= 0; i-- {
+			vod := vods[i]
+			if done[vod.ID] || vod.Status == "RECORDING" {
+				continue
+			}
+			j := defaults
+			j.url = "https://www.twitch.tv/videos/" + vod.ID
+			if err := j.run(); err != nil {
+				failed++
+				log.Printf("FAILED  %s: %v", j.url, err)
+				if jsonOutput {
+					emitError(j.url, err)
+				}
+				continue
+			}
+			if err := recordArchive(archiveFile, vod.ID); err != nil {
+				return err
+			}
+			done[vod.ID] = true
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d downloads failed", failed)
+	}
+	return nil
+}
+
+// readArchive returns the IDs recorded in the archive file at path.
+// A missing file records no ID.
+func readArchive(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return map[string]bool{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Cannot open file %s", path)
+	}
+	defer f.Close()
+	return parseArchive(f)
+}
+
+func parseArchive(r io.Reader) (map[string]bool, error) {
+	ids := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); len(id) > 0 {
+			ids[id] = true
+		}
+	}
+	return ids, errors.WithStack(scanner.Err())
+}
+
+// recordArchive appends id to the archive file at path.
+func recordArchive(path, id string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot open file %s", path)
+	}
+	if _, err := fmt.Fprintln(f, id); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "Writing to file %s failed", path)
+	}
+	return errors.Wrapf(f.Close(), "Closing file %s failed", path)
+}
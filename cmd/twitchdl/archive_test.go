@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "archive.txt")
+
+	ids, err := readArchive(path)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	require.NoError(t, recordArchive(path, "1"))
+	require.NoError(t, recordArchive(path, "2"))
+	ids, err = readArchive(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"1": true, "2": true}, ids)
+
+	ids, err = parseArchive(strings.NewReader("3\n\n  4 \r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"3": true, "4": true}, ids)
+}
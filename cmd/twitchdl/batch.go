@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/pkg/errors"
+)
+
+// readBatch reads the jobs listed in the file at path, or in stdin if path
+// is "-".
+func readBatch(path string) ([]job, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot open file %s", path)
+		}
+		defer f.Close()
+		r = f
+	}
+	return parseBatch(r, batchDefaults())
+}
+
+// batchDefaults returns the job holding the values of the download flags.
+// Quality defaults to best.
+func batchDefaults() job {
+	defaults := job{quality: quality, start: start, end: end, duration: duration, output: output}
+	if len(defaults.quality) == 0 {
+		defaults.quality = twitchdl.QualityBest
+	}
+	return defaults
+}
+
+// runJobs runs jobs with at most concurrency jobs at the same time and
+// prints a summary once every download is over. The summary and the events
+// are written to stderr when a job writes the video to stdout.
+func runJobs(jobs []job) error {
+	n := concurrency
+	if n < 1 {
+		n = 1
+	}
+	var w io.Writer = os.Stdout
+	for i := range jobs {
+		if jobs[i].output != stdout {
+			continue
+		}
+		if len(jobs) > 1 {
+			return errors.New("Several downloads cannot be written to stdout")
+		}
+		w = os.Stderr
+		eventsMu.Lock()
+		eventsW = os.Stderr
+		eventsMu.Unlock()
+	}
+	if err := sharedOutput(jobs); err != nil {
+		return err
+	}
+	for i := range jobs {
+		jobs[i].progress = n == 1
+	}
+
+	results := make([]error, len(jobs))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = jobs[i].run()
+			if results[i] != nil && jsonOutput {
+				emitError(jobs[i].url, results[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	return summarize(w, jobs, results)
+}
+
+// sharedOutput returns an error if several jobs write to the same file: an
+// output that is neither a template nor a directory.
+func sharedOutput(jobs []job) error {
+	seen := map[string]string{}
+	for _, j := range jobs {
+		if strings.Contains(j.output, "{") {
+			continue
+		}
+		if _, file := filepath.Split(j.output); len(file) == 0 {
+			continue
+		}
+		path := filepath.Clean(j.output)
+		if u, ok := seen[path]; ok {
+			return errors.Errorf("%s and %s cannot both be written to %s, use a template such as -o \"{id}.{ext}\"", u, j.url, j.output)
+		}
+		seen[path] = j.url
+	}
+	return nil
+}
+
+// summarize prints the outcome of each job and returns an error if any failed.
+func summarize(w io.Writer, jobs []job, results []error) error {
+	var succeeded, skipped, failed int
+	var lines []string
+	for i, err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Cause(err) == errSkipped:
+			skipped++
+			lines = append(lines, fmt.Sprintf("SKIPPED %s: %v", jobs[i].url, err))
+		default:
+			failed++
+			lines = append(lines, fmt.Sprintf("FAILED  %s: %v", jobs[i].url, err))
+		}
+	}
+	if jsonOutput {
+		emit(event{Event: "summary", Succeeded: &succeeded, Skipped: &skipped, Failed: &failed})
+	} else {
+		fmt.Fprintf(w, "Summary: %d succeeded, %d skipped, %d failed\n", succeeded, skipped, failed)
+		for _, l := range lines {
+			fmt.Fprintln(w, l)
+		}
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d downloads failed", failed, len(jobs))
+	}
+	return nil
+}
+
+// parseBatch reads one URL per line. Each URL can be followed by overrides of
+// defaults such as "https://www.twitch.tv/videos/123 start=1h end=2h q=720p30".
+// Empty lines and lines starting with "#" are ignored. The job of a malformed
+// line fails with the parsing error once run.
+func parseBatch(r io.Reader, defaults job) ([]job, error) {
+	var jobs []job
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		j := defaults
+		j.url = fields[0]
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			var err error
+			if len(kv) != 2 {
+				j.err = errors.Errorf("line %d: malformed override %q", n, field)
+				break
+			}
+			switch kv[0] {
+			case "q", "quality":
+				j.quality = kv[1]
+			case "start":
+				j.start, err = twitchdl.ParseTimestamp(kv[1])
+			case "end":
+				j.end, err = twitchdl.ParseTimestamp(kv[1])
+			case "duration":
+				j.duration, err = twitchdl.ParseTimestamp(kv[1])
+			case "o", "output":
+				j.output = kv[1]
+			default:
+				err = errors.Errorf("unknown override %q", kv[0])
+			}
+			if err != nil {
+				j.err = errors.Wrapf(err, "line %d", n)
+				break
+			}
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, errors.WithStack(scanner.Err())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatch(t *testing.T) {
+	input := `# comment
+https://www.twitch.tv/videos/1
+
+https://www.twitch.tv/videos/2 q=720p30 start=1h end=1h30m o=out.ts
+  https://clips.twitch.tv/Slug quality=360p30
+https://www.twitch.tv/videos/3 start=1:02:03 duration=30m
+https://www.twitch.tv/videos/4 end=-10:00
+`
+	defaults := job{quality: "best", output: "dir/"}
+	jobs, err := parseBatch(strings.NewReader(input), defaults)
+	require.NoError(t, err)
+	assert.Equal(t, []job{
+		{url: "https://www.twitch.tv/videos/1", quality: "best", output: "dir/"},
+		{url: "https://www.twitch.tv/videos/2", quality: "720p30", start: time.Hour, end: 90 * time.Minute, output: "out.ts"},
+		{url: "https://clips.twitch.tv/Slug", quality: "360p30", output: "dir/"},
+		{url: "https://www.twitch.tv/videos/3", quality: "best", start: time.Hour + 2*time.Minute + 3*time.Second, duration: 30 * time.Minute, output: "dir/"},
+		{url: "https://www.twitch.tv/videos/4", quality: "best", end: -10 * time.Minute, output: "dir/"},
+	}, jobs)
+
+	jobs, err = parseBatch(strings.NewReader(`https://www.twitch.tv/videos/1 start
+https://www.twitch.tv/videos/2 start=abc
+https://www.twitch.tv/videos/3 unknown=1
+https://www.twitch.tv/videos/4
+`), defaults)
+	require.NoError(t, err)
+	require.Len(t, jobs, 4)
+	for _, j := range jobs[:3] {
+		assert.Error(t, j.run(), j.url)
+	}
+	assert.EqualError(t, jobs[0].err, `line 1: malformed override "start"`)
+	assert.NoError(t, jobs[3].err)
+}
+
+func TestSummarize(t *testing.T) {
+	jobs := []job{{url: "a"}, {url: "b"}, {url: "c"}}
+	exists := errors.Wrap(&os.PathError{Op: "open", Path: "c.ts", Err: os.ErrExist}, "Cannot create file c.ts")
+	var b bytes.Buffer
+
+	err := summarize(&b, jobs, []error{nil, errors.Wrap(errSkipped, "b.ts"), exists})
+	assert.Error(t, err)
+	assert.Equal(t, `Summary: 1 succeeded, 1 skipped, 1 failed
+SKIPPED b: b.ts: output already exists
+FAILED  c: Cannot create file c.ts: open c.ts: file already exists
+`, b.String())
+
+	b.Reset()
+	assert.NoError(t, summarize(&b, jobs, []error{nil, errors.Wrap(errSkipped, "b.ts"), nil}))
+}
+
+func TestRunJobsStdout(t *testing.T) {
+	defer func(w io.Writer, j bool) { eventsW, jsonOutput = w, j }(eventsW, jsonOutput)
+	defer func(o, e *os.File) { os.Stdout, os.Stderr = o, e }(os.Stdout, os.Stderr)
+
+	for _, j := range []bool{false, true} {
+		jsonOutput = j
+		outR, outW, err := os.Pipe()
+		require.NoError(t, err)
+		errR, errW, err := os.Pipe()
+		require.NoError(t, err)
+		os.Stdout, os.Stderr = outW, errW
+		// The job fails before downloading anything, only the summary and
+		// the events are written.
+		jobs := []job{{url: "https://www.twitch.tv/videos/1", output: stdout, err: errors.New("line 1: malformed override")}}
+		assert.Error(t, runJobs(jobs))
+		outW.Close()
+		errW.Close()
+		out, err := ioutil.ReadAll(outR)
+		require.NoError(t, err)
+		events, err := ioutil.ReadAll(errR)
+		require.NoError(t, err)
+		assert.Empty(t, string(out), "json %t", j)
+		if j {
+			assert.Contains(t, string(events), `"event":"summary"`)
+		} else {
+			assert.Contains(t, string(events), "Summary: 0 succeeded, 0 skipped, 1 failed")
+		}
+	}
+}
+
+func TestSharedOutput(t *testing.T) {
+	for _, outputs := range [][]string{
+		{"a.ts", "b.ts"},
+		{"dir/", "dir/"},
+		{"", ""},
+		{"{id}.{ext}", "{id}.{ext}"},
+	} {
+		jobs := []job{{url: "1", output: outputs[0]}, {url: "2", output: outputs[1]}}
+		assert.NoError(t, sharedOutput(jobs), "%v", outputs)
+	}
+	for _, outputs := range [][]string{
+		{"video.ts", "video.ts"},
+		{"dir/video.ts", "dir/../dir/video.ts"},
+	} {
+		jobs := []job{{url: "1", output: outputs[0]}, {url: "2", output: outputs[1]}}
+		assert.Error(t, sharedOutput(jobs), "%v", outputs)
+	}
+	assert.EqualError(t, runJobs([]job{{url: "1", output: "video.ts"}, {url: "2", output: "video.ts"}}), `1 and 2 cannot both be written to video.ts, use a template such as -o "{id}.{ext}"`)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/pkg/errors"
+)
+
+// ffmpeg is the executable remuxing videos to embed chapters.
+var ffmpeg = "ffmpeg"
+
+// chapterFormats are the ffmpeg formats of the outputs chapters are
+// embedded into.
+var chapterFormats = map[string]string{".mp4": "mp4", ".mkv": "matroska"}
+
+// writeVODChapters writes the chapters of the VOD downloaded at path to an
+// ffmetadata file and embeds them into the video if it is an MP4 or MKV.
+func writeVODChapters(path string, meta twitchdl.Metadata, info twitchdl.Info) error {
+	chapters, err := twitchdl.VODChapters(context.Background(), httpClient, defaultClientID, meta.VOD.ID)
+	if err != nil {
+		return errors.Wrap(err, "Retrieving chapters failed")
+	}
+	ranges := info.Ranges
+	if len(ranges) == 0 {
+		ranges = []twitchdl.Range{{Start: info.Start, End: info.End}}
+	}
+	metadataPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".ffmetadata"
+	if err := createFile(metadataPath, func(w io.Writer) error {
+		return twitchdl.WriteFFMetadata(w, meta.Name(), twitchdl.ClipChapters(chapters, ranges))
+	}); err != nil {
+		return err
+	}
+	return embedChapters(path, metadataPath)
+}
+
+// embedChapters remuxes the video at path with the chapters of the
+// ffmetadata file at metadataPath if path is an MP4 or MKV. Other videos are
+// left untouched.
+func embedChapters(path, metadataPath string) error {
+	format, ok := chapterFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil
+	}
+	tmp := path + partSuffix
+	cmd := exec.Command(ffmpeg, "-y", "-loglevel", "error", "-i", path, "-i", metadataPath,
+		"-map", "0", "-map_metadata", "1", "-map_chapters", "1", "-c", "copy", "-f", format, tmp)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "Embedding chapters into %s with %s failed", path, ffmpeg)
+	}
+	return errors.WithStack(os.Rename(tmp, path))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedChapters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(p string) { ffmpeg = p }(ffmpeg)
+
+	// The fake ffmpeg writes its arguments to its output, the last argument.
+	ffmpeg = filepath.Join(dir, "ffmpeg")
+	require.NoError(t, ioutil.WriteFile(ffmpeg, []byte("#!/bin/sh\nfor last; do :; done\necho \"$@\" > \"$last\"\n"), 0755))
+
+	ts := filepath.Join(dir, "video.ts")
+	require.NoError(t, ioutil.WriteFile(ts, []byte("ts"), 0666))
+	require.NoError(t, embedChapters(ts, "video.ffmetadata"))
+	b, err := ioutil.ReadFile(ts)
+	require.NoError(t, err)
+	assert.Equal(t, "ts", string(b))
+
+	mkv := filepath.Join(dir, "video.mkv")
+	require.NoError(t, ioutil.WriteFile(mkv, []byte("ts"), 0666))
+	require.NoError(t, embedChapters(mkv, "video.ffmetadata"))
+	b, err = ioutil.ReadFile(mkv)
+	require.NoError(t, err)
+	assert.Equal(t, "-y -loglevel error -i "+mkv+" -i video.ffmetadata -map 0 -map_metadata 1 -map_chapters 1 -c copy -f matroska "+mkv+".part\n", string(b))
+	_, err = os.Stat(mkv + partSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	ffmpeg = filepath.Join(dir, "missing")
+	assert.Error(t, embedChapters(mkv, "video.ffmetadata"))
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// command is a subcommand such as "twitchdl download".
+type command struct {
+	name  string
+	args  string
+	short string
+	// local commands do not use the twitch API.
+	local bool
+	// flags are the flags of the command besides the global flags.
+	flags *flag.FlagSet
+	run   func(args []string) error
+}
+
+// commands is assigned in init as some commands refer to it.
+var commands []command
+
+// Flags of the channel commands.
+var videoType, listType, archiveFile, addr, serveToken, serveRoot string
+var limit, listLimit int
+var interval time.Duration
+var limitWindows []window
+
+func init() {
+	commands = []command{
+		{name: "info", args: "<url>", short: "Print the metadata and the qualities of a video.", run: runInfo},
+		{name: "qualities", args: "<url>", short: "Print the qualities of a video, best first.", run: runQualities},
+		{name: "download", args: "<url>...", short: "Download videos. Quality defaults to \"best\".", flags: flagGroup(func(fs *flag.FlagSet) {
+			fs.StringVar(&batch, "a", "", "Path to a file listing one URL per line, or \"-\" to read stdin. (optional)")
+			addFlags(fs, downloadSet)
+		}), run: runDownload},
+		{name: "chat", args: "<url>", short: "Download the chat replay of a VOD as newline-delimited JSON.", flags: flagGroup(func(fs *flag.FlagSet) {
+			fs.StringVar(&output, "o", "", "Path where the chat will be written, or \"-\" to write it to stdout. Defaults to \"{channel} - {title}.chat.json\". (optional)")
+		}), run: runChat},
+		{name: "list", args: "<channel>", short: "List the VODs of a channel, most recent first.", flags: flagGroup(func(fs *flag.FlagSet) {
+			fs.StringVar(&listType, "type", "all", "Type of the VODs: archive, highlight, upload or all. (optional)")
+			fs.IntVar(&listLimit, "limit", 20, "Maximum number of VODs. 0 lists every VOD. (optional)")
+		}), run: runList},
+		{name: "archive", args: "<channel>...", short: "Download the VODs of channels not downloaded yet.", flags: flagGroup(func(fs *flag.FlagSet) {
+			addFlags(fs, downloadSet)
+			addFlags(fs, archiveSet)
+		}), run: runArchive},
+		{name: "watch", args: "<channel>...", short: "Archive channels periodically.", flags: flagGroup(func(fs *flag.FlagSet) {
+			addFlags(fs, downloadSet)
+			addFlags(fs, archiveSet)
+			fs.DurationVar(&interval, "interval", 10*time.Minute, "Time between two checks of the channels. (optional)")
+		}), run: runWatch},
+		{name: "serve", short: "Serve an HTTP API queueing downloads.", flags: flagGroup(func(fs *flag.FlagSet) {
+			fs.StringVar(&addr, "addr", "localhost:8080", "Address to listen on. (optional)")
+			fs.StringVar(&serveToken, "token", "", "Token required by the HTTP API in an \"Authorization: Bearer <token>\" header.\nA random token is generated and printed when empty. (optional)")
+			fs.StringVar(&serveRoot, "root", ".", "Directory the downloads are written in. Outputs are relative to it and cannot contain \"..\". (optional)")
+			addFlags(fs, downloadSet)
+		}), run: runServe},
+		{name: "verify", args: "<file>...", short: "Check the structure of downloaded MPEG-TS and MP4 files.", local: true, run: runVerify},
+		{name: "completion", args: "bash|zsh|fish", short: "Print the shell completion script.", local: true, run: runCompletion},
+		{name: "help", args: "[command]", short: "Print the help of a command.", local: true, run: help},
+	}
+}
+
+// findCommand returns the command called name or nil.
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flags of c including the global flags. The flags are
+// registered once, building their flag set again keeps their values.
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	addFlags(fs, globalSet)
+	if c.flags != nil {
+		addFlags(fs, c.flags)
+	}
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage: twitchdl %s [flags] %s\n\n%s\n\nFlags:\n", c.name, c.args, c.short)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// help prints the usage of the command named by args[0], or the usage of
+// twitchdl.
+func help(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return nil
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		return errors.Errorf("unknown command %q", args[0])
+	}
+	c.flagSet().Usage()
+	return nil
+}
+
+// oneArg returns the single argument of the command name.
+func oneArg(name string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.Errorf("%s expects a single argument, got %d", name, len(args))
+	}
+	return args[0], nil
+}
+
+func runInfo(args []string) error {
+	u, err := oneArg("info", args)
+	if err != nil {
+		return err
+	}
+	meta, err := twitchdl.FetchMetadata(context.Background(), httpClient, defaultClientID, u)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving metadata for URL %s failed", u)
+	}
+	qualities, err := twitchdl.QualityDetails(context.Background(), httpClient, defaultClientID, u)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving qualities for URL %s failed", u)
+	}
+	if jsonOutput {
+		return printInfo(os.Stdout, meta, qualities)
+	}
+	f := meta.Fields()
+	fmt.Printf("Title:     %s\nChannel:   %s\nDate:      %s\nDuration:  %s\n", f.Title, f.Channel, f.Date.Format(time.RFC3339), f.End)
+	if len(f.Game) > 0 {
+		fmt.Printf("Game:      %s\n", f.Game)
+	}
+	fmt.Printf("Qualities:\n")
+	for _, q := range qualities {
+		fmt.Printf("  %-12s %dx%d %.0ffps\n", q.Name, q.Width, q.Height, q.FrameRate)
+	}
+	return nil
+}
+
+func runQualities(args []string) error {
+	u, err := oneArg("qualities", args)
+	if err != nil {
+		return err
+	}
+	qualities, err := twitchdl.QualityDetails(context.Background(), httpClient, defaultClientID, u)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving qualities for URL %s failed", u)
+	}
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errors.WithStack(enc.Encode(qualities))
+	}
+	for _, q := range qualities {
+		fmt.Println(q.Name)
+	}
+	return nil
+}
+
+func runDownload(args []string) error {
+	if len(quality) == 0 {
+		quality = twitchdl.QualityBest
+	}
+	var jobs []job
+	if len(batch) > 0 {
+		var err error
+		if jobs, err = readBatch(batch); err != nil {
+			return err
+		}
+	}
+	for _, u := range args {
+		j := batchDefaults()
+		j.url = u
+		jobs = append(jobs, j)
+	}
+	switch len(jobs) {
+	case 0:
+		return errors.New("download expects at least one URL")
+	case 1:
+		j := jobs[0]
+		j.progress = true
+		return j.run()
+	}
+	return runJobs(jobs)
+}
+
+func runChat(args []string) error {
+	u, err := oneArg("chat", args)
+	if err != nil {
+		return err
+	}
+	meta, err := twitchdl.FetchMetadata(context.Background(), httpClient, defaultClientID, u)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving metadata for URL %s failed", u)
+	}
+	if meta.Type != twitch.TypeVOD {
+		return errors.Errorf("chat replays are only available for VODs: %s", u)
+	}
+	path := output
+	if len(path) == 0 {
+		fields := meta.Fields()
+		fields.Ext = "chat.json"
+		if path, err = twitchdl.Filename("{channel} - {title}.{ext}", fields); err != nil {
+			return err
+		}
+	}
+	api := twitch.New(httpClient, defaultClientID)
+	write := func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		return api.Comments(context.Background(), meta.VOD.ID, func(c twitch.Comment) error {
+			return errors.WithStack(enc.Encode(c))
+		})
+	}
+	if path == stdout {
+		return write(os.Stdout)
+	}
+	fmt.Fprintf(os.Stderr, "Downloading: %s\n", path)
+	return createFile(path, write)
+}
+
+// broadcastType parses the -type flag.
+func broadcastType(s string) (twitch.BroadcastType, error) {
+	switch s = strings.ToLower(s); s {
+	case "", "all":
+		return "", nil
+	case "archive", "highlight", "upload":
+		return twitch.BroadcastType(strings.ToUpper(s)), nil
+	}
+	return "", errors.Errorf("unknown type %q", s)
+}
+
+func runList(args []string) error {
+	login, err := oneArg("list", args)
+	if err != nil {
+		return err
+	}
+	bt, err := broadcastType(listType)
+	if err != nil {
+		return err
+	}
+	api := twitch.New(httpClient, defaultClientID)
+	vods, err := api.ChannelVideos(context.Background(), login, bt, listLimit)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving VODs of channel %s failed", login)
+	}
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return errors.WithStack(enc.Encode(vods))
+	}
+	for _, vod := range vods {
+		fmt.Printf("%s\t%s\t%s\t%s\n", vod.ID, vod.CreatedAt.Format("2006-01-02"), vod.Duration(), vod.Title)
+	}
+	return nil
+}
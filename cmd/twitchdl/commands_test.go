@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagSetKeepsValues(t *testing.T) {
+	defer func(q, c string, l int) { quality, clientID, listLimit = q, c, l }(quality, clientID, listLimit)
+
+	require.NoError(t, findCommand("download").flagSet().Parse([]string{"-q", "720p30", "-client-id", "id"}))
+	require.NoError(t, findCommand("list").flagSet().Parse([]string{"-limit", "5"}))
+	// Completion and usage build the flag sets again.
+	require.NoError(t, completion(ioutil.Discard, "fish"))
+	fs := findCommand("download").flagSet()
+
+	assert.Equal(t, "720p30", quality)
+	assert.Equal(t, "id", clientID)
+	assert.Equal(t, 5, listLimit)
+	assert.Equal(t, "720p30", fs.Lookup("q").Value.String())
+	assert.Equal(t, "", fs.Lookup("q").DefValue)
+	assert.Equal(t, "3", fs.Lookup("concurrency").DefValue)
+	// list and archive have their own defaults for -type and -limit.
+	assert.Equal(t, "all", findCommand("list").flagSet().Lookup("type").Value.String())
+	assert.Equal(t, "archive", findCommand("archive").flagSet().Lookup("type").Value.String())
+}
+
+func TestBroadcastType(t *testing.T) {
+	for s, expected := range map[string]twitch.BroadcastType{
+		"":          "",
+		"all":       "",
+		"archive":   twitch.BroadcastType("ARCHIVE"),
+		"Highlight": twitch.BroadcastType("HIGHLIGHT"),
+		"upload":    twitch.BroadcastType("UPLOAD"),
+	} {
+		bt, err := broadcastType(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, bt, s)
+	}
+	_, err := broadcastType("live")
+	assert.EqualError(t, err, `unknown type "live"`)
+}
+
+func TestChat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(c *http.Client, o string) { httpClient, output = c, o }(httpClient, output)
+	httpClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		b, _ := ioutil.ReadAll(req.Body)
+		body := `{"data":{"video":{"id":"1","title":"Title"}}}`
+		if strings.Contains(string(b), "comments") {
+			body = `{"data":{"video":{"comments":{"edges":[
+				{"cursor":"c1","node":{"id":"a","contentOffsetSeconds":1,"commenter":{"login":"user","displayName":"User"},"message":{"fragments":[{"text":"hello"}]}}},
+				{"cursor":"c2","node":{"id":"b","contentOffsetSeconds":5,"commenter":null,"message":{"fragments":[{"text":"bye"}]}}}
+			],"pageInfo":{"hasNextPage":false}}}}}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+	})}
+	output = filepath.Join(dir, "chat.json")
+
+	require.NoError(t, runChat([]string{"https://www.twitch.tv/videos/1"}))
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer f.Close()
+	var comments []twitch.Comment
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var c twitch.Comment
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &c))
+		comments = append(comments, c)
+	}
+	require.Len(t, comments, 2)
+	assert.Equal(t, "hello", comments[0].Message)
+	assert.Equal(t, 5, comments[1].OffsetSeconds)
+
+	assert.Error(t, runChat(nil))
+}
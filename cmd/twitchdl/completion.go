@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func runCompletion(args []string) error {
+	shell, err := oneArg("completion", args)
+	if err != nil {
+		return err
+	}
+	return completion(os.Stdout, shell)
+}
+
+// completion writes the completion script of shell, generated from the
+// commands and their flags.
+func completion(w io.Writer, shell string) error {
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	switch shell {
+	case "bash":
+		fmt.Fprintf(w, "_twitchdl() {\n  local cur=${COMP_WORDS[COMP_CWORD]}\n")
+		fmt.Fprintf(w, "  if [ \"$COMP_CWORD\" -eq 1 ]; then\n    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n    return\n  fi\n", strings.Join(names, " "))
+		fmt.Fprintf(w, "  case ${COMP_WORDS[1]} in\n")
+		for i := range commands {
+			fmt.Fprintf(w, "    %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", commands[i].name, strings.Join(flagNames(&commands[i]), " "))
+		}
+		fmt.Fprintf(w, "  esac\n}\ncomplete -o default -F _twitchdl twitchdl\n")
+	case "zsh":
+		fmt.Fprintf(w, "#compdef twitchdl\n\n_twitchdl() {\n  if (( CURRENT == 2 )); then\n    local -a commands\n    commands=(\n")
+		for _, c := range commands {
+			fmt.Fprintf(w, "      %s\n", shellQuote(shell, c.name+":"+c.short))
+		}
+		fmt.Fprintf(w, "    )\n    _describe 'command' commands\n    return\n  fi\n  case $words[2] in\n")
+		for i := range commands {
+			fmt.Fprintf(w, "    %s) compadd -- %s ;;\n", commands[i].name, strings.Join(flagNames(&commands[i]), " "))
+		}
+		fmt.Fprintf(w, "  esac\n  _files\n}\n\ncompdef _twitchdl twitchdl\n")
+	case "fish":
+		fmt.Fprintf(w, "complete -c twitchdl -f\n")
+		for _, c := range commands {
+			fmt.Fprintf(w, "complete -c twitchdl -n __fish_use_subcommand -a %s -d %s\n", c.name, shellQuote(shell, c.short))
+		}
+		for i := range commands {
+			c := &commands[i]
+			c.flagSet().VisitAll(func(f *flag.Flag) {
+				usage := strings.SplitN(f.Usage, "\n", 2)[0]
+				fmt.Fprintf(w, "complete -c twitchdl -n '__fish_seen_subcommand_from %s' -o %s -d %s\n", c.name, f.Name, shellQuote(shell, usage))
+			})
+		}
+	default:
+		return errors.Errorf("unknown shell %q, expected bash, zsh or fish", shell)
+	}
+	return nil
+}
+
+// flagNames returns the flags of c such as "-q".
+func flagNames(c *command) []string {
+	var names []string
+	c.flagSet().VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	return names
+}
+
+// shellQuote quotes s for shell.
+func shellQuote(shell, s string) string {
+	if shell == "fish" {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
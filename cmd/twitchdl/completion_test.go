@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletion(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, completion(&b, "bash"))
+	assert.Contains(t, b.String(), `COMPREPLY=($(compgen -W "info qualities download chat list archive watch serve verify completion help" -- "$cur"))`)
+	assert.Contains(t, b.String(), "    watch) COMPREPLY=($(compgen -W \"-archive-file")
+
+	b.Reset()
+	require.NoError(t, completion(&b, "zsh"))
+	assert.Contains(t, b.String(), `'list:List the VODs of a channel, most recent first.'`)
+
+	b.Reset()
+	require.NoError(t, completion(&b, "fish"))
+	assert.Contains(t, b.String(), `complete -c twitchdl -n '__fish_seen_subcommand_from serve' -o addr -d 'Address to listen on. (optional)'`)
+
+	assert.EqualError(t, completion(&b, "powershell"), `unknown shell "powershell", expected bash, zsh or fish`)
+}
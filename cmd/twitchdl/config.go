@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// configKeys maps the keys of the config file to the flags they set.
+// The environment variable of a key is its upper case name prefixed by
+// "TWITCHDL_" such as TWITCHDL_CLIENT_ID.
+var configKeys = map[string]string{
+	"client_id":   "client-id",
+	"oauth_token": "oauth-token",
+	"quality":     "q",
+	"output":      "o",
+	"on_exist":    "on-exist",
+	"concurrency": "concurrency",
+	"rate_limit":  "rate-limit",
+	"proxy":       "proxy",
+	"retries":     "retries",
+	"retry_delay": "retry-delay",
+	"cdn_hosts":   "cdn-hosts",
+	"limit_rate":  "limit-rate",
+	"serve_token": "token",
+}
+
+// configPath returns the path of the config file: $TWITCHDL_CONFIG if set,
+// $XDG_CONFIG_HOME/twitchdl/config.toml otherwise.
+func configPath() string {
+	if path := os.Getenv("TWITCHDL_CONFIG"); len(path) > 0 {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if len(dir) == 0 {
+		var err error
+		if dir, err = userConfigDir(); err != nil {
+			return ""
+		}
+	}
+	return filepath.Join(dir, "twitchdl", "config.toml")
+}
+
+// userConfigDir returns the default directory of the user configuration
+// files: %AppData% on Windows, ~/Library/Application Support on macOS and
+// ~/.config elsewhere.
+func userConfigDir() (string, error) {
+	var dir string
+	switch runtime.GOOS {
+	case "windows":
+		if dir = os.Getenv("AppData"); len(dir) == 0 {
+			return "", errors.New("%AppData% is not defined")
+		}
+	case "darwin":
+		if dir = os.Getenv("HOME"); len(dir) == 0 {
+			return "", errors.New("$HOME is not defined")
+		}
+		dir = filepath.Join(dir, "Library", "Application Support")
+	default:
+		if dir = os.Getenv("HOME"); len(dir) == 0 {
+			return "", errors.New("$HOME is not defined")
+		}
+		dir = filepath.Join(dir, ".config")
+	}
+	return dir, nil
+}
+
+// loadConfig sets the flags of fs from the config file at path then from
+// the environment. Flags are meant to be parsed afterwards so that the
+// command line has the final say. A missing config file is ignored.
+func loadConfig(fs *flag.FlagSet, path string, getenv func(string) string) error {
+	if len(path) > 0 {
+		values := map[string]interface{}{}
+		if _, err := toml.DecodeFile(path, &values); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Reading config file %s failed", path)
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := configKeys[key]; !ok {
+				return errors.Errorf("Unknown key %q in config file %s", key, path)
+			}
+			value, err := configValue(values[key])
+			if err == nil {
+				err = setFlag(fs, key, value)
+			} else {
+				err = errors.Wrapf(err, "%s", key)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "Invalid config file %s", path)
+			}
+		}
+	}
+	keys := make([]string, 0, len(configKeys))
+	for key := range configKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env := "TWITCHDL_" + strings.ToUpper(key)
+		if value := getenv(env); len(value) > 0 {
+			if err := setFlag(fs, key, value); err != nil {
+				return errors.Wrapf(err, "Invalid environment variable %s", env)
+			}
+		}
+	}
+	return nil
+}
+
+// configValue returns the flag value of the TOML value v. Numbers are
+// written in full and arrays are comma separated, as -cdn-hosts expects.
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		elems := make([]string, len(v))
+		for i, e := range v {
+			s, err := configValue(e)
+			if err != nil {
+				return "", err
+			}
+			elems[i] = s
+		}
+		return strings.Join(elems, ","), nil
+	default:
+		return "", errors.Errorf("unsupported value %v", v)
+	}
+}
+
+// setFlag sets the flag of the config key if fs defines it.
+func setFlag(fs *flag.FlagSet, key, value string) error {
+	name := configKeys[key]
+	if fs.Lookup(name) == nil {
+		return nil
+	}
+	return errors.Wrapf(fs.Set(name, value), "%s", key)
+}
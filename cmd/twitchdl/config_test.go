@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	defer func(id, q string, c, r int, d time.Duration, l float64) {
+		clientID, quality, concurrency, retries, retryDelay, rateLimit = id, q, c, r, d, l
+	}(clientID, quality, concurrency, retries, retryDelay, rateLimit)
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+client_id = "from-file"
+quality = "720p30"
+concurrency = 5
+retry_delay = "5s"
+rate_limit = 2.5
+`), 0666))
+
+	env := map[string]string{"TWITCHDL_QUALITY": "best", "TWITCHDL_RETRIES": "7"}
+	c := findCommand("download")
+	fs := c.flagSet()
+	require.NoError(t, loadConfig(fs, path, func(k string) string { return env[k] }))
+	require.NoError(t, fs.Parse([]string{"-concurrency", "1", "https://www.twitch.tv/videos/1"}))
+
+	assert.Equal(t, "from-file", clientID)
+	assert.Equal(t, "best", quality)
+	assert.Equal(t, 1, concurrency)
+	assert.Equal(t, 7, retries)
+	assert.Equal(t, 5*time.Second, retryDelay)
+	assert.Equal(t, 2.5, rateLimit)
+
+	// Keys whose flag is not defined by the command are ignored.
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	require.NoError(t, loadConfig(fs, path, func(string) string { return "" }))
+	require.NoError(t, loadConfig(fs, filepath.Join(dir, "missing.toml"), func(string) string { return "" }))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`colour = "red"`), 0666))
+	assert.EqualError(t, loadConfig(c.flagSet(), path, func(string) string { return "" }), `Unknown key "colour" in config file `+path)
+
+	env = map[string]string{"TWITCHDL_CONCURRENCY": "many"}
+	require.NoError(t, ioutil.WriteFile(path, nil, 0666))
+	assert.Error(t, loadConfig(c.flagSet(), path, func(k string) string { return env[k] }))
+}
+
+func TestLoadConfigValues(t *testing.T) {
+	defer func(h string, l int64, r float64, c int) {
+		cdnHosts, limitRate, rateLimit, concurrency = h, l, r, c
+	}(cdnHosts, limitRate, rateLimit, concurrency)
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`
+cdn_hosts = ["a.test", "b.test"]
+limit_rate = 2.5e6
+rate_limit = 1e6
+concurrency = 12
+`), 0666))
+
+	fs := findCommand("download").flagSet()
+	require.NoError(t, loadConfig(fs, path, func(string) string { return "" }))
+	assert.Equal(t, "a.test,b.test", cdnHosts)
+	assert.Equal(t, int64(2500000), limitRate)
+	assert.Equal(t, 1e6, rateLimit)
+	assert.Equal(t, 12, concurrency)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`retries = {count = 1}`), 0666))
+	assert.Error(t, loadConfig(fs, path, func(string) string { return "" }))
+}
+
+func TestConfigValue(t *testing.T) {
+	for v, expected := range map[interface{}]string{
+		"720p30":        "720p30",
+		int64(10000000): "10000000",
+		2e6:             "2000000",
+		0.25:            "0.25",
+		true:            "true",
+	} {
+		actual, err := configValue(v)
+		require.NoError(t, err, v)
+		assert.Equal(t, expected, actual, v)
+	}
+	actual, err := configValue([]interface{}{"a.test", int64(1)})
+	require.NoError(t, err)
+	assert.Equal(t, "a.test,1", actual)
+}
+
+func TestConfigPath(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("uses $HOME/.config")
+	}
+	for _, key := range []string{"TWITCHDL_CONFIG", "XDG_CONFIG_HOME", "HOME"} {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+	os.Setenv("TWITCHDL_CONFIG", "")
+	os.Setenv("XDG_CONFIG_HOME", "")
+	os.Setenv("HOME", "/home/user")
+	assert.Equal(t, filepath.Join("/home/user", ".config", "twitchdl", "config.toml"), configPath())
+	os.Setenv("XDG_CONFIG_HOME", "/xdg")
+	assert.Equal(t, filepath.Join("/xdg", "twitchdl", "config.toml"), configPath())
+	os.Setenv("TWITCHDL_CONFIG", "/config.toml")
+	assert.Equal(t, "/config.toml", configPath())
+}
+
+func TestSetupWithoutClientID(t *testing.T) {
+	defer func(d, id string, c *http.Client) { defaultClientID, clientID, httpClient = d, id, c }(defaultClientID, clientID, httpClient)
+	defaultClientID, clientID = "", ""
+	err := setup(true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "No twitch.tv client ID configured")
+	assert.NoError(t, setup(false))
+}
+
+func TestAuthTransport(t *testing.T) {
+	var auth []string
+	rt := &authTransport{
+		rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			auth = append(auth, req.Header.Get("Authorization"))
+			return httptest.NewRecorder().Result(), nil
+		}),
+		token: "secret",
+	}
+	client := &http.Client{Transport: rt}
+	for _, u := range []string{"https://gql.twitch.tv/gql", "https://usher.ttvnw.net/vod/1.m3u8"} {
+		resp, err := client.Get(u)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"OAuth secret", ""}, auth)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// job is the download of a single URL.
+type job struct {
+	url        string
+	quality    string
+	start, end time.Duration
+	duration   time.Duration
+	ranges     []twitchdl.Range
+	output     string
+	// source is the URL downloaded when it differs from url, such as the
+	// source VOD of a padded clip.
+	source string
+	// err is the error of a malformed batch line, returned by run.
+	err error
+	// progress prints the download progress.
+	progress bool
+}
+
+// run downloads the video of j or prints its qualities if j.quality is empty.
+func (j job) run() error {
+	if j.err != nil {
+		return j.err
+	}
+	// Honor the offset of share links such as "?t=1h2m3s".
+	if video, err := twitch.Parse(j.url); err == nil && j.start == 0 && video.Start > 0 {
+		j.start = video.Start
+	}
+
+	meta, err := twitchdl.FetchMetadata(context.Background(), httpClient, defaultClientID, j.url)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving name for URL %s failed", j.url)
+	}
+	name := meta.Name()
+
+	// A padded clip is downloaded from the range of its source VOD, whose
+	// qualities are used.
+	j.source = j.url
+	if clipPadding > 0 && meta.Type == twitch.TypeClip {
+		j.source, j.start, j.end, err = twitchdl.ClipContext(context.Background(), httpClient, defaultClientID, j.url, clipPadding)
+		if err != nil {
+			return errors.Wrapf(err, "Retrieving source VOD for URL %s failed", j.url)
+		}
+		j.duration = 0
+	}
+
+	if len(j.quality) == 0 && jsonOutput {
+		qualities, err := twitchdl.QualityDetails(context.Background(), httpClient, defaultClientID, j.source)
+		if err != nil {
+			return errors.Wrapf(err, "Retrieving qualities for URL %s failed", j.url)
+		}
+		return printInfo(os.Stdout, meta, qualities)
+	}
+	if len(j.quality) == 0 {
+		qualities, err := twitchdl.Qualities(context.Background(), httpClient, defaultClientID, j.source)
+		if err != nil {
+			return errors.Wrapf(err, "Retrieving qualities for URL %s failed", j.url)
+		}
+		fmt.Printf("%s\n%s\n", name, strings.Join(qualities, "\n"))
+		return nil
+	}
+	// Each VOD of a collection resolves the best quality on its own as they
+	// do not share the same renditions.
+	if j.quality == twitchdl.QualityBest && meta.Type != twitch.TypeCollection {
+		qualities, err := twitchdl.Qualities(context.Background(), httpClient, defaultClientID, j.source)
+		if err != nil || len(qualities) == 0 {
+			return errors.Wrapf(err, "Retrieving qualities for URL %s failed", j.url)
+		}
+		j.quality = qualities[0]
+	}
+
+	opts := twitchdl.Options{
+		Quality:    j.quality,
+		Start:      j.start,
+		End:        j.end,
+		Duration:   j.duration,
+		Retries:    retries,
+		RetryDelay: retryDelay,
+		Unmuted:    unmuted,
+		GapFill:    twitchdl.GapFill(gapFill),
+		Limiter:    limiter,
+	}
+	for _, host := range strings.Split(cdnHosts, ",") {
+		if host = strings.TrimSpace(host); len(host) > 0 {
+			opts.Hosts = append(opts.Hosts, host)
+		}
+	}
+	if jsonOutput {
+		opts.Events = libraryEvents(j.url)
+	}
+
+	if meta.Type == twitch.TypeCollection {
+		if j.start != 0 || j.end != 0 || j.duration != 0 || len(j.ranges) > 0 {
+			return errors.Errorf("-start, -end, -duration and -range are not supported for collections: %s", j.url)
+		}
+		if collectionMerge {
+			return j.runCollectionMerged(meta, opts)
+		}
+		if j.output == stdout {
+			return errors.New("Writing a collection to stdout requires -collection-merge")
+		}
+		return j.runCollection(*meta.Collection, opts)
+	}
+
+	if len(chapter) > 0 || splitByChapter {
+		if meta.Type != twitch.TypeVOD {
+			return errors.Errorf("-chapter and -split-by-chapter are only supported for VODs: %s", j.url)
+		}
+		if len(j.ranges) > 0 {
+			return errors.New("-range cannot be combined with -chapter or -split-by-chapter")
+		}
+		if splitByChapter {
+			return j.runChapters(meta, opts)
+		}
+		opts.Chapter = chapter
+	}
+
+	if len(j.ranges) > 0 {
+		if meta.Type != twitch.TypeVOD {
+			return errors.Errorf("-range is only supported for VODs: %s", j.url)
+		}
+		if !rangesMerge {
+			return j.runRanges(meta, opts, nil)
+		}
+		opts.Ranges = j.ranges
+		j.start, j.end, j.duration = j.ranges[0].Start, j.ranges[len(j.ranges)-1].End, 0
+	}
+
+	if splitDuration > 0 || splitSize > 0 {
+		opts.SplitDuration, opts.SplitSize = splitDuration, splitSize
+		return j.runParts(meta, opts)
+	}
+
+	path, err := j.outputPath(j.output, meta.Fields())
+	if err != nil {
+		return err
+	}
+	if path, opts.Resume, err = target(path); err != nil {
+		return err
+	}
+	download, err := twitchdl.DownloadWithOptions(context.Background(), httpClient, defaultClientID, j.source, opts)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving stream for URL %s failed", j.url)
+	}
+	startedAt := time.Now()
+	if err := j.save(download, path, opts.Resume); err != nil {
+		return err
+	}
+	info := download.Info()
+	report(j.url, path, info)
+	return writeSidecars(path, meta, &info, startedAt)
+}
+
+// runCollection downloads each VOD of a collection into its own numbered file.
+// The directory of the output is honored, its filename is not unless it is a
+// template.
+func (j job) runCollection(collection twitch.Collection, opts twitchdl.Options) error {
+	out := j.output
+	if !strings.Contains(out, "{") {
+		out, _ = filepath.Split(out)
+	}
+	for i, vod := range collection.VODs {
+		vod := vod
+		meta := twitchdl.Metadata{Type: twitch.TypeVOD, VOD: &vod}
+		fields := meta.Fields()
+		fields.Title = fmt.Sprintf("%s - %02d - %s", collection.Title, i+1, vod.Title)
+		path, err := j.outputPath(out, fields)
+		if err != nil {
+			return err
+		}
+		path, opts.Resume, err = target(path)
+		if errors.Cause(err) == errSkipped {
+			fmt.Fprintf(os.Stderr, "Skipped: %v\n", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		download, err := twitchdl.DownloadWithOptions(context.Background(), httpClient, defaultClientID, vod.ID, opts)
+		if err != nil {
+			return errors.Wrapf(err, "Retrieving stream for VOD %s failed", vod.ID)
+		}
+		startedAt := time.Now()
+		if err := j.save(download, path, opts.Resume); err != nil {
+			return err
+		}
+		info := download.Info()
+		report(vod.ID, path, info)
+		if err := writeSidecars(path, meta, &info, startedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runChapters downloads each chapter of the VOD, or each chapter matching
+// -chapter, into its own file suffixed by its number and title.
+func (j job) runChapters(meta twitchdl.Metadata, opts twitchdl.Options) error {
+	chapters, err := twitchdl.VODChapters(context.Background(), httpClient, defaultClientID, j.url)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving chapters for URL %s failed", j.url)
+	}
+	if len(chapter) > 0 {
+		chapters = twitchdl.MatchChapters(chapters, chapter)
+	}
+	if len(chapters) == 0 {
+		return errors.Errorf("No chapter to download for URL %s", j.url)
+	}
+	j.ranges = nil
+	var names []string
+	for i, c := range chapters {
+		j.ranges = append(j.ranges, twitchdl.Range{Start: c.Start, End: c.End})
+		names = append(names, fmt.Sprintf("%02d %s", i+1, separators.Replace(c.Title)))
+	}
+	return j.runRanges(meta, opts, names)
+}
+
+// separators replaces the path separators of a value added to a filename.
+var separators = strings.NewReplacer("/", "_", `\`, "_")
+
+// runRanges downloads each range of j.ranges into its own file. Files are
+// suffixed by names if not nil. Otherwise, unless the output template holds
+// {start}, files are suffixed by the number of their range.
+func (j job) runRanges(meta twitchdl.Metadata, opts twitchdl.Options, names []string) error {
+	if j.output == stdout && len(j.ranges) > 1 {
+		return errors.New("Several ranges cannot be written to stdout without -ranges-merge")
+	}
+	var paths []string
+	for i, r := range j.ranges {
+		rj := j
+		rj.start, rj.end, rj.duration = r.Start, r.End, 0
+		path, err := rj.outputPath(j.output, meta.Fields())
+		if err != nil {
+			return err
+		}
+		switch ext := filepath.Ext(path); {
+		case path == stdout:
+		case names != nil:
+			path = fmt.Sprintf("%s - %s%s", strings.TrimSuffix(path, ext), names[i], ext)
+		case len(j.ranges) > 1 && !strings.Contains(j.output, "{start}"):
+			path = fmt.Sprintf("%s - range %d%s", strings.TrimSuffix(path, ext), i+1, ext)
+		}
+		path, resume, err := target(path)
+		if errors.Cause(err) == errSkipped {
+			fmt.Fprintf(os.Stderr, "Skipped: %v\n", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		opts.Ranges = append(opts.Ranges, r)
+		opts.RangeResumes = append(opts.RangeResumes, resume)
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	streams, err := twitchdl.DownloadRanges(context.Background(), httpClient, defaultClientID, j.url, opts)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving streams for URL %s failed", j.url)
+	}
+	for i, stream := range streams {
+		startedAt := time.Now()
+		if err := j.save(stream, paths[i], opts.RangeResumes[i]); err != nil {
+			return err
+		}
+		info := stream.Info()
+		report(j.url, paths[i], info)
+		if err := writeSidecars(paths[i], meta, &info, startedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runParts downloads the video split into parts. Unless the output template
+// holds {part}, files are suffixed by the number of their part.
+func (j job) runParts(meta twitchdl.Metadata, opts twitchdl.Options) error {
+	if j.output == stdout {
+		return errors.New("Parts cannot be written to stdout")
+	}
+	parts, err := twitchdl.DownloadParts(context.Background(), httpClient, defaultClientID, j.source, opts)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving stream for URL %s failed", j.url)
+	}
+	defer parts.Close()
+	for i := 1; ; i++ {
+		part, err := parts.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fields := meta.Fields()
+		fields.Part = i
+		path, err := j.outputPath(j.output, fields)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(j.output, "{part}") {
+			ext := filepath.Ext(path)
+			path = fmt.Sprintf("%s - part %02d%s", strings.TrimSuffix(path, ext), i, ext)
+		}
+		// Parts are read one after the other: the content of a part that is
+		// not written is downloaded anyway and discarded.
+		path, resume, err := target(path)
+		if errors.Cause(err) == errSkipped {
+			fmt.Fprintf(os.Stderr, "Skipped: %v\n", err)
+			if _, err := io.Copy(ioutil.Discard, part); err != nil {
+				return errors.Wrapf(err, "Retrieving part %d of URL %s failed", i, j.url)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := parts.Resume(resume); err != nil {
+			return errors.Wrapf(err, "Resuming %s failed", path)
+		}
+		startedAt := time.Now()
+		if err := j.save(part, path, resume); err != nil {
+			return err
+		}
+		info := part.Info()
+		report(j.url, path, info)
+		if err := writeSidecars(path, meta, &info, startedAt); err != nil {
+			return err
+		}
+	}
+}
+
+// runCollectionMerged downloads the VODs of a collection into a single file
+// along with an ffmetadata file holding a chapter for each VOD.
+func (j job) runCollectionMerged(meta twitchdl.Metadata, opts twitchdl.Options) error {
+	path, err := j.outputPath(j.output, meta.Fields())
+	if err != nil {
+		return err
+	}
+	if path, opts.Resume, err = target(path); err != nil {
+		return err
+	}
+	download, chapters, err := twitchdl.DownloadCollection(context.Background(), httpClient, defaultClientID, j.url, opts)
+	if err != nil {
+		return errors.Wrapf(err, "Retrieving stream for URL %s failed", j.url)
+	}
+	startedAt := time.Now()
+	if err := j.save(download, path, opts.Resume); err != nil {
+		return err
+	}
+	if path == stdout {
+		return nil
+	}
+	metadataPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".ffmetadata"
+	if err := createFile(metadataPath, func(w io.Writer) error {
+		return twitchdl.WriteFFMetadata(w, meta.Name(), chapters)
+	}); err != nil {
+		return err
+	}
+	if writeChapters {
+		if err := embedChapters(path, metadataPath); err != nil {
+			return err
+		}
+	}
+	return writeSidecars(path, meta, nil, startedAt)
+}
+
+// stdout is the output writing the video to stdout.
+const stdout = "-"
+
+// outputPath returns the path of the file described by fields.
+// output is either stdout, a filename template, a file path or a directory in
+// which case twitchdl.DefaultTemplate is used.
+func (j job) outputPath(output string, fields twitchdl.Fields) (string, error) {
+	if output == stdout {
+		return stdout, nil
+	}
+	fields.Quality = j.quality
+	// The length of the VOD from its metadata resolves relative timestamps
+	// close enough for a filename. Invalid ranges are reported by the
+	// download.
+	start, end, err := twitchdl.ResolveRange(fields.End, j.start, j.end, j.duration)
+	if err == nil {
+		fields.Start = start
+		if end > 0 {
+			fields.End = end
+		}
+	}
+	fields.Ext = "ts"
+	if strings.Contains(strings.ToLower(j.quality), "audio") {
+		fields.Ext = "aac"
+	}
+	if strings.Contains(output, "{") {
+		path, err := twitchdl.Filename(filepath.ToSlash(output), fields)
+		return path, errors.Wrapf(err, "Invalid output template %s", output)
+	}
+	dir, filename := filepath.Split(output)
+	if len(filename) > 0 {
+		return output, nil
+	}
+	filename, err = twitchdl.Filename(twitchdl.DefaultTemplate, fields)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filename), nil
+}
+
+// errSkipped is returned when the output exists and the -on-exist policy
+// is skip or resume.
+var errSkipped = errors.New("output already exists")
+
+// target applies the -on-exist policy to the output path. It returns the
+// path to download to and the number of bytes already downloaded to its
+// partial file when resuming.
+func target(path string) (string, int64, error) {
+	if path == stdout {
+		return path, 0, nil
+	}
+	_, err := os.Stat(path)
+	exists := err == nil
+	switch onExist {
+	case "fail":
+		if exists {
+			return "", 0, errors.Wrapf(&os.PathError{Op: "create", Path: path, Err: os.ErrExist}, "Cannot create file %s", path)
+		}
+	case "skip":
+		if exists {
+			return "", 0, errors.Wrap(errSkipped, path)
+		}
+	case "overwrite":
+	case "rename":
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		for i := 1; exists; i++ {
+			path = fmt.Sprintf("%s (%d)%s", base, i, ext)
+			_, err = os.Stat(path)
+			exists = err == nil
+		}
+	case "resume":
+		if exists {
+			return "", 0, errors.Wrap(errSkipped, path)
+		}
+		if fi, err := os.Stat(path + partSuffix); err == nil {
+			return path, fi.Size(), nil
+		}
+	default:
+		return "", 0, errors.Errorf("Invalid -on-exist policy %q, expected fail, skip, overwrite, rename or resume", onExist)
+	}
+	return path, 0, nil
+}
+
+// partSuffix is appended to the path of a download until it is complete.
+const partSuffix = ".part"
+
+// save writes download to the partial file of output, appending to it if
+// resume is positive, and renames it to output once complete.
+// If output is stdout, download is written to stdout.
+func (j job) save(download io.Reader, output string, resume int64) error {
+	if output == stdout {
+		return j.copy(os.Stdout, download, output)
+	}
+	if dir := filepath.Dir(output); len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return errors.Wrapf(err, "Cannot create directory %s", dir)
+		}
+	}
+	part := output + partSuffix
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(part, flags, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot create file %s", part)
+	}
+	defer f.Close()
+	if err := j.copy(f, download, output); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "Closing file %s failed", output)
+	}
+	if _, err := os.Stat(output); err == nil && onExist != "overwrite" {
+		return errors.Wrapf(&os.PathError{Op: "rename", Path: output, Err: os.ErrExist}, "Cannot rename file %s", part)
+	}
+	return errors.Wrapf(os.Rename(part, output), "Cannot rename file %s", part)
+}
+
+// copy copies download to w while reporting the progress to stderr, or as
+// JSON events.
+func (j job) copy(w io.Writer, download io.Reader, output string) error {
+	var c *counter
+	switch {
+	case jsonOutput:
+		c = &counter{r: download}
+		download = c
+		emit(event{Event: "started", URL: j.url, Path: output, Quality: j.quality})
+	case j.progress:
+		fmt.Fprintf(os.Stderr, "Downloading: %s\n", output)
+		download = &reader{r: download}
+	default:
+		fmt.Fprintf(os.Stderr, "Downloading: %s\n", output)
+	}
+	if _, err := io.Copy(w, download); err != nil {
+		return errors.Wrapf(err, "Writing to file %s failed", output)
+	}
+	switch {
+	case jsonOutput:
+		emit(event{Event: "finished", URL: j.url, Path: output, Quality: j.quality, Bytes: c.n})
+	case j.progress:
+		fmt.Fprintf(os.Stderr, "\rDone%-25s\n", " ")
+	default:
+		fmt.Fprintf(os.Stderr, "Done: %s\n", output)
+	}
+	return nil
+}
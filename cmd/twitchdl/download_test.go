@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(p string) { onExist = p }(onExist)
+
+	path := filepath.Join(dir, "video.ts")
+	for _, p := range []string{"fail", "skip", "overwrite", "rename", "resume"} {
+		onExist = p
+		actual, resume, err := target(path)
+		require.NoError(t, err, p)
+		assert.Equal(t, path, actual, p)
+		assert.Zero(t, resume, p)
+	}
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("video"), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "video (1).ts"), []byte("video"), 0666))
+
+	onExist = "fail"
+	_, _, err = target(path)
+	assert.True(t, os.IsExist(errors.Cause(err)))
+	onExist = "skip"
+	_, _, err = target(path)
+	assert.Equal(t, errSkipped, errors.Cause(err))
+	onExist = "overwrite"
+	actual, _, err := target(path)
+	require.NoError(t, err)
+	assert.Equal(t, path, actual)
+	onExist = "rename"
+	actual, _, err = target(path)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "video (2).ts"), actual)
+	onExist = "resume"
+	_, _, err = target(path)
+	assert.Equal(t, errSkipped, errors.Cause(err))
+
+	partial := filepath.Join(dir, "partial.ts")
+	require.NoError(t, ioutil.WriteFile(partial+partSuffix, []byte("abc"), 0666))
+	actual, resume, err := target(partial)
+	require.NoError(t, err)
+	assert.Equal(t, partial, actual)
+	assert.Equal(t, int64(3), resume)
+
+	require.NoError(t, job{}.save(strings.NewReader("def"), partial, resume))
+	b, err := ioutil.ReadFile(partial)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", string(b))
+	_, err = os.Stat(partial + partSuffix)
+	assert.True(t, os.IsNotExist(err))
+
+	actual, resume, err = target(stdout)
+	require.NoError(t, err)
+	assert.Equal(t, stdout, actual)
+	assert.Zero(t, resume)
+
+	onExist = "unknown"
+	_, _, err = target(path)
+	assert.Error(t, err)
+}
+
+func TestCollectionRange(t *testing.T) {
+	defer func(c *http.Client) { httpClient = c }(httpClient)
+	httpClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req, Body: ioutil.NopCloser(strings.NewReader(
+			`{"data":{"collection":{"id":"abc","title":"Playlist","items":{"edges":[{"cursor":"c1","node":{"id":"1","lengthSeconds":60}}],"pageInfo":{"hasNextPage":false}}}}}`,
+		))}, nil
+	})}
+	for _, j := range []job{
+		{url: "https://www.twitch.tv/collections/abc", quality: "best", start: time.Minute},
+		{url: "https://www.twitch.tv/collections/abc", quality: "best", duration: time.Minute},
+	} {
+		err := j.run()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not supported for collections")
+	}
+}
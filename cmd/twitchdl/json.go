@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// event is a line of the newline-delimited JSON printed by -json.
+type event struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	URL      string    `json:"url,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Quality  string    `json:"quality,omitempty"`
+	Segment  *int      `json:"segment,omitempty"`
+	Segments int       `json:"segments,omitempty"`
+	Bytes    int64     `json:"bytes,omitempty"`
+	Attempt  int       `json:"attempt,omitempty"`
+	Code     string    `json:"code,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	// Ranges are the muted ranges of a download in seconds.
+	Ranges [][2]float64 `json:"ranges,omitempty"`
+	// Summary of a batch.
+	Succeeded *int `json:"succeeded,omitempty"`
+	Skipped   *int `json:"skipped,omitempty"`
+	Failed    *int `json:"failed,omitempty"`
+}
+
+var (
+	eventsMu sync.Mutex
+	eventsW  io.Writer = os.Stdout
+)
+
+// emit prints e as a single JSON line.
+func emit(e event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	json.NewEncoder(eventsW).Encode(e)
+}
+
+// libraryEvents returns the twitchdl.Options.Events func emitting the
+// events of the download of url.
+func libraryEvents(url string) func(twitchdl.Event) {
+	return func(e twitchdl.Event) {
+		segment := e.Segment
+		ev := event{Event: string(e.Type), URL: url, Quality: e.Quality, Segment: &segment, Segments: e.Segments, Bytes: e.Bytes, Attempt: e.Attempt}
+		if e.Err != nil {
+			ev.Message = e.Err.Error()
+		}
+		emit(ev)
+	}
+}
+
+// report reports the muted ranges and the gaps of the download of url at
+// path. With -json, gaps are reported by gap events as they are filled.
+func report(url, path string, info twitchdl.Info) {
+	if jsonOutput {
+		if len(info.Muted) == 0 {
+			return
+		}
+		var ranges [][2]float64
+		for _, r := range info.Muted {
+			ranges = append(ranges, [2]float64{r.Start.Seconds(), r.End.Seconds()})
+		}
+		emit(event{Event: "muted", URL: url, Path: path, Ranges: ranges})
+		return
+	}
+	if len(info.Muted) > 0 {
+		var ranges []string
+		for _, r := range info.Muted {
+			ranges = append(ranges, fmt.Sprintf("%v-%v", r.Start, r.End))
+		}
+		fmt.Fprintf(os.Stderr, "Muted ranges of %s: %s\n", path, strings.Join(ranges, ", "))
+	}
+	for _, g := range info.Gaps {
+		if len(g.Quality) == 0 {
+			fmt.Fprintf(os.Stderr, "Segment %d of %s (%v-%v) is missing\n", g.Segment, path, g.Start, g.End)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Segment %d of %s (%v-%v) was downloaded in %s\n", g.Segment, path, g.Start, g.End, g.Quality)
+	}
+}
+
+// emitError emits the error event of the download of url.
+func emitError(url string, err error) {
+	emit(event{Event: "error", URL: url, Code: errorCode(err), Message: err.Error()})
+}
+
+// errorCode classifies err for scripts.
+func errorCode(err error) string {
+	cause := errors.Cause(err)
+	switch {
+	case cause == twitch.ErrNotFound:
+		return "not_found"
+	case cause == twitchdl.ErrSourceVODUnavailable:
+		return "source_vod_unavailable"
+	case os.IsExist(cause):
+		return "file_exists"
+	}
+	if apiErr, ok := cause.(*twitch.Error); ok {
+		if apiErr.StatusCode == 0 {
+			return "network_error"
+		}
+		return "api_error"
+	}
+	return "error"
+}
+
+// printInfo prints the metadata and the qualities of a video as one JSON document.
+func printInfo(w io.Writer, meta twitchdl.Metadata, qualities []twitchdl.Quality) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(struct {
+		Metadata  twitchdl.Metadata  `json:"metadata"`
+		Qualities []twitchdl.Quality `json:"qualities"`
+	}{meta, qualities}))
+}
+
+// counter counts the bytes read from r.
+type counter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCode(t *testing.T) {
+	tcs := []struct {
+		err      error
+		expected string
+	}{
+		{errors.Wrap(twitch.ErrNotFound, "VOD 1"), "not_found"},
+		{errors.Wrap(twitchdl.ErrSourceVODUnavailable, "clip a"), "source_vod_unavailable"},
+		{errors.Wrap(&os.PathError{Op: "open", Path: "a.ts", Err: os.ErrExist}, "Cannot create file"), "file_exists"},
+		{errors.WithStack(&twitch.Error{StatusCode: 500}), "api_error"},
+		{errors.WithStack(&twitch.Error{}), "network_error"},
+		{errors.New("boom"), "error"},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, errorCode(tc.err), tc.err.Error())
+	}
+}
+
+func TestEmit(t *testing.T) {
+	var b bytes.Buffer
+	eventsW = &b
+	defer func() { eventsW = os.Stdout }()
+
+	libraryEvents("url")(twitchdl.Event{Type: twitchdl.EventSegment, Segment: 0, Segments: 2, Bytes: 10})
+	emitError("url", errors.Wrap(twitch.ErrNotFound, "VOD 1"))
+
+	dec := json.NewDecoder(&b)
+	var e map[string]interface{}
+	require.NoError(t, dec.Decode(&e))
+	delete(e, "time")
+	assert.Equal(t, map[string]interface{}{"event": "segment", "url": "url", "segment": 0.0, "segments": 2.0, "bytes": 10.0}, e)
+	e = nil
+	require.NoError(t, dec.Decode(&e))
+	delete(e, "time")
+	assert.Equal(t, map[string]interface{}{"event": "error", "url": "url", "code": "not_found", "message": "VOD 1: not found"}, e)
+}
+
+func TestReport(t *testing.T) {
+	var b bytes.Buffer
+	eventsW = &b
+	defer func() { eventsW = os.Stdout }()
+	defer func(v bool) { jsonOutput = v }(jsonOutput)
+	jsonOutput = true
+
+	report("url", "a.ts", twitchdl.Info{})
+	report("url", "a.ts", twitchdl.Info{Muted: []twitchdl.Range{{Start: 10 * time.Second, End: 30 * time.Second}}})
+
+	var e map[string]interface{}
+	require.NoError(t, json.NewDecoder(&b).Decode(&e))
+	delete(e, "time")
+	assert.Equal(t, map[string]interface{}{"event": "muted", "url": "url", "path": "a.ts", "ranges": []interface{}{[]interface{}{10.0, 30.0}}}, e)
+}
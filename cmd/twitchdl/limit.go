@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/pkg/errors"
+)
+
+// limiter caps the bandwidth shared by every download.
+var limiter = twitchdl.NewLimiter(0)
+
+// limitMu guards limitRate once downloads started.
+var limitMu sync.Mutex
+
+// scheduleOnce and signalOnce start the goroutines updating limiter once.
+var scheduleOnce, signalOnce sync.Once
+
+// window is a time of day range with its own bandwidth cap.
+type window struct {
+	// start and end are offsets from midnight. A window ending before it
+	// starts spans midnight.
+	start, end time.Duration
+	rate       int64
+}
+
+// contains reports whether the time of day of t is in w.
+func (w window) contains(t time.Time) bool {
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.start <= w.end {
+		return d >= w.start && d < w.end
+	}
+	return d >= w.start || d < w.end
+}
+
+// windowsValue is the flag.Value of -limit-window.
+type windowsValue struct {
+	windows *[]window
+}
+
+func (v windowsValue) String() string {
+	if v.windows == nil {
+		return ""
+	}
+	var s []string
+	for _, w := range *v.windows {
+		s = append(s, fmt.Sprintf("%s-%s=%d", clock(w.start), clock(w.end), w.rate))
+	}
+	return strings.Join(s, " ")
+}
+
+func (v windowsValue) Set(s string) error {
+	w, err := parseWindow(s)
+	if err != nil {
+		return err
+	}
+	*v.windows = append(*v.windows, w)
+	return nil
+}
+
+// parseWindow parses a window such as "22:00-07:00=0" or "09:00-18:00=2MB".
+func parseWindow(s string) (window, error) {
+	i := strings.Index(s, "=")
+	j := strings.Index(s, "-")
+	if i < 0 || j < 0 || j > i {
+		return window{}, errors.Errorf("invalid window %q, expected HH:MM-HH:MM=RATE", s)
+	}
+	var w window
+	var err error
+	if w.start, err = parseClock(s[:j]); err != nil {
+		return window{}, err
+	}
+	if w.end, err = parseClock(s[j+1 : i]); err != nil {
+		return window{}, err
+	}
+	if w.rate, err = parseSize(s[i+1:]); err != nil {
+		return window{}, err
+	}
+	return w, nil
+}
+
+// parseClock parses a time of day such as "07:30".
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errors.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func clock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// currentRate returns the rate of the first window containing t, or
+// limitRate outside windows.
+func currentRate(windows []window, t time.Time) int64 {
+	for _, w := range windows {
+		if w.contains(t) {
+			return w.rate
+		}
+	}
+	limitMu.Lock()
+	defer limitMu.Unlock()
+	return limitRate
+}
+
+// applyLimits sets the rate of limiter now and then every minute according
+// to limitWindows.
+func applyLimits() {
+	limiter.SetRate(currentRate(limitWindows, time.Now()))
+	if len(limitWindows) == 0 {
+		return
+	}
+	scheduleOnce.Do(func() {
+		go func() {
+			for range time.Tick(time.Minute) {
+				limiter.SetRate(currentRate(limitWindows, time.Now()))
+			}
+		}()
+	})
+}
+
+// reloadLimitOnSignal reloads -limit-rate from the config file and the
+// environment on SIGHUP. The value in effect now, such as the one given on
+// the command line, applies when neither sets it.
+func reloadLimitOnSignal() {
+	signalOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		limitMu.Lock()
+		base := limitRate
+		limitMu.Unlock()
+		go reloadLimit(c, base)
+	})
+}
+
+// reloadLimit reloads limitRate every time c receives a signal. base is the
+// rate when the config file and the environment do not set it.
+func reloadLimit(c <-chan os.Signal, base int64) {
+	for range c {
+		fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+		rate := base
+		fs.Var(sizeValue{&rate}, "limit-rate", "")
+		if err := loadConfig(fs, configPath(), os.Getenv); err != nil {
+			fmt.Fprintf(os.Stderr, "Reloading the bandwidth limit failed: %v\n", err)
+			continue
+		}
+		limitMu.Lock()
+		limitRate = rate
+		limitMu.Unlock()
+		limiter.SetRate(currentRate(limitWindows, time.Now()))
+		fmt.Fprintf(os.Stderr, "Bandwidth limit set to %d B/s\n", limiter.Rate())
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindow(t *testing.T) {
+	w, err := parseWindow("22:00-07:30=2MB")
+	require.NoError(t, err)
+	assert.Equal(t, window{start: 22 * time.Hour, end: 7*time.Hour + 30*time.Minute, rate: 2000000}, w)
+	for _, s := range []string{"22:00=0", "22:00-07:00", "25:00-07:00=0", "22:00-07:00=fast"} {
+		_, err := parseWindow(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCurrentRate(t *testing.T) {
+	defer func(r int64) { limitRate = r }(limitRate)
+	limitRate = 2000000
+	windows := []window{{start: 22 * time.Hour, end: 7 * time.Hour, rate: 0}, {start: 12 * time.Hour, end: 13 * time.Hour, rate: 500000}}
+	at := func(hour int) time.Time { return time.Date(2021, 1, 1, hour, 30, 0, 0, time.Local) }
+	assert.Equal(t, int64(0), currentRate(windows, at(23)))
+	assert.Equal(t, int64(0), currentRate(windows, at(3)))
+	assert.Equal(t, int64(2000000), currentRate(windows, at(9)))
+	assert.Equal(t, int64(500000), currentRate(windows, at(12)))
+	assert.Equal(t, "22:00-07:00=0 12:00-13:00=500000", windowsValue{&windows}.String())
+}
+
+func TestReloadLimit(t *testing.T) {
+	defer func(r int64) { limitRate = r }(limitRate)
+	defer limiter.SetRate(0)
+	defer os.Setenv("TWITCHDL_CONFIG", os.Getenv("TWITCHDL_CONFIG"))
+	defer os.Setenv("TWITCHDL_LIMIT_RATE", os.Getenv("TWITCHDL_LIMIT_RATE"))
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`quality = "best"`), 0666))
+	os.Setenv("TWITCHDL_CONFIG", path)
+	os.Setenv("TWITCHDL_LIMIT_RATE", "")
+
+	reload := func() {
+		c := make(chan os.Signal, 1)
+		c <- syscall.SIGHUP
+		close(c)
+		reloadLimit(c, 3000)
+	}
+	// The command line value is kept when the config file does not set it.
+	reload()
+	assert.Equal(t, int64(3000), limitRate)
+	assert.Equal(t, int64(3000), limiter.Rate())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`limit_rate = "2MB"`), 0666))
+	reload()
+	assert.Equal(t, int64(2000000), limitRate)
+
+	os.Setenv("TWITCHDL_LIMIT_RATE", "0")
+	reload()
+	assert.Equal(t, int64(0), limitRate)
+}
@@ -1,18 +1,22 @@
 package main
 
 import (
-	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/jybp/twitch-downloader/twitch"
 	"github.com/pkg/errors"
 )
 
@@ -20,102 +24,393 @@ import (
 // go build -ldflags "-X main.defaultClientID=YourClientID"
 var defaultClientID string
 
-// Flags
-var clientID, url, quality, output string
-var start, end time.Duration
-var verbose bool
+// Injected at build time using the -ldflags flag.
+var version = "dev"
+
+// Global flags shared by every command.
+var clientID, oauthToken, proxy, trace string
+var rateLimit float64
+var verbose, jsonOutput bool
+
+// Download flags.
+var url, batch, quality, output, onExist, chapter, gapFill, cdnHosts string
+var start, end, duration, splitDuration, clipPadding, retryDelay time.Duration
+var splitSize, limitRate int64
+var concurrency, retries int
+var collectionMerge, rangesMerge, splitByChapter, unmuted, writeInfoJSON, writeNFO, writeThumbnail, writeChapters bool
+var ranges []twitchdl.Range
+
+// Flags shared by several commands. Each flag is registered once then added
+// to the flag sets of the commands with addFlags.
+var (
+	globalSet   = flagGroup(globalFlags)
+	downloadSet = flagGroup(downloadFlags)
+	archiveSet  = flagGroup(archiveFlags)
+)
+
+// httpClient performs every request. It honors the proxy, OAuth token and
+// rate limit flags.
+var httpClient = http.DefaultClient
 
 func init() {
 	log.SetFlags(0)
 
-	flag.StringVar(&url, "url", "", `The URL of the twitch VOD or Clip to download.`)
-	flag.StringVar(&quality, "q", "", "Quality of the video to download. Omit this flag to print the available qualities.\nUse \"best\" to automatically select the highest quality.")
-	flag.StringVar(&output, "o", "", "Path where the video will be downloaded. Example: `-o my-video.ts`. (optional)")
-	flag.DurationVar(&start, "start", time.Duration(0), "Specify \"start\" to download a subset of the VOD. Example: 1h23m45s (optional)")
-	flag.DurationVar(&end, "end", time.Duration(0), "Specify \"end\" to download a subset of the VOD. Example: 1h34m56s (optional)")
-	flag.StringVar(&clientID, "client-id", "", "Use a specific twitch.tv API client ID. (optional)")
-	flag.BoolVar(&verbose, "v", false, "Verbose errors. (optional)")
-	flag.Parse()
+	// Flat flags predating commands, still supported for compatibility.
+	flag.StringVar(&url, "url", "", `The URL of the twitch VOD, Clip or Collection, or the HLS playlist URL or .m3u8 file to download.`)
+	flag.StringVar(&batch, "a", "", "Path to a file listing one URL per line, or \"-\" to read stdin. Each URL can be followed by\noverrides such as `q=720p30 start=1h end=2h o=video.ts`. Quality defaults to \"best\". (optional)")
+	addFlags(flag.CommandLine, downloadSet)
+	addFlags(flag.CommandLine, globalSet)
+	flag.Usage = usage
+}
+
+// flagGroup returns the flag set of the flags registered by register.
+func flagGroup(register func(fs *flag.FlagSet)) *flag.FlagSet {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	register(fs)
+	return fs
+}
+
+// addFlags adds the flags of group to fs. Unlike registering them again, it
+// keeps their current values.
+func addFlags(fs *flag.FlagSet, group *flag.FlagSet) {
+	group.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+		fs.Lookup(f.Name).DefValue = f.DefValue
+	})
+}
+
+// globalFlags registers the flags shared by every command.
+func globalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&clientID, "client-id", "", "Use a specific twitch.tv API client ID. (optional)")
+	fs.StringVar(&oauthToken, "oauth-token", "", "OAuth token of a twitch.tv account, required to download subscriber-only VODs. (optional)")
+	fs.Float64Var(&rateLimit, "rate-limit", 0, "Maximum number of HTTP requests per second. 0 means no limit. (optional)")
+	fs.StringVar(&proxy, "proxy", "", "URL of the HTTP or SOCKS5 proxy to use. Example: socks5://localhost:1080 (optional)")
+	fs.BoolVar(&verbose, "v", false, "Verbose errors. (optional)")
+	fs.StringVar(&trace, "trace", "", "Path where the trace of a failed twitch.tv API request is written as JSON. Secrets are redacted. (optional)")
+	fs.BoolVar(&jsonOutput, "json", false, "Print the metadata and the qualities of the video as JSON, and the progress of downloads as\nnewline-delimited JSON events: started, segment, retry, unmuted, gap, muted, finished, error and summary. (optional)")
+}
+
+// downloadFlags registers the flags configuring downloads.
+func downloadFlags(fs *flag.FlagSet) {
+	fs.IntVar(&concurrency, "concurrency", 3, "Maximum number of downloads running at the same time with -a. (optional)")
+	fs.StringVar(&quality, "q", "", "Quality of the video to download. Omit this flag to print the available qualities.\nUse \"best\" to automatically select the highest quality.")
+	fs.StringVar(&output, "o", "", "Path where the video will be downloaded, or \"-\" to write it to stdout. Example: `-o my-video.ts`.\nCan be a template using {channel}, {login}, {title}, {id}, {date}, {date:2006-01-02}, {game}, {quality}, {start}, {end}, {part} and {ext}.\nDirectories are created as needed. Example: `-o \"{login}/{date} {title}.{ext}\"` (optional)")
+	fs.StringVar(&onExist, "on-exist", "fail", "What to do when the output file exists: fail, skip, overwrite, rename to \"name (1).ts\" or resume\nthe partial .part file left by an interrupted download. (optional)")
+	timestampVar(fs, &start, "start", "Specify \"start\" to download a subset of the VOD. Examples: 1h23m45s, 1:23:45, 83:45, 5025.\nNegative values are relative to the end of the VOD. Example: -10m (optional)")
+	timestampVar(fs, &end, "end", "Specify \"end\" to download a subset of the VOD. Examples: 1h34m56s, 1:34:56.\nNegative values are relative to the end of the VOD. Example: -10m (optional)")
+	ranges = nil
+	fs.Var(rangesValue{&ranges}, "range", "Range of the VOD to download such as 1:00:00-1:05:00 or -20m--10m. Can be repeated to download\nseveral ranges with a single playlist fetch, each into its own file unless -ranges-merge is set. (optional)")
+	fs.BoolVar(&rangesMerge, "ranges-merge", false, "Download the ranges of -range one after the other into a single file. (optional)")
+	fs.StringVar(&chapter, "chapter", "", "Download the chapters of the VOD whose title or game is \"chapter\". Example: -chapter \"Elden Ring\" (optional)")
+	fs.BoolVar(&splitByChapter, "split-by-chapter", false, "Download each chapter of the VOD into its own file suffixed by the chapter title.\nWith -chapter, only the matching chapters are downloaded. (optional)")
+	timestampVar(fs, &splitDuration, "split-duration", "Split the video into parts of at most \"split-duration\" at segment boundaries. Example: 1h (optional)")
+	splitSize = 0
+	fs.Var(sizeValue{&splitSize}, "split-size", "Split the video into parts of at most \"split-size\" at segment boundaries, estimated from the size\nof the segments already downloaded. Example: 4GiB (optional)")
+	timestampVar(fs, &duration, "duration", "Download \"duration\" from \"start\" instead of specifying \"end\". Example: 30m (optional)")
+	fs.DurationVar(&clipPadding, "clip-padding", time.Duration(0), "Download the source VOD of a clip from \"clip-padding\" before the clip to \"clip-padding\" after it. Example: 2m (optional)")
+	fs.BoolVar(&collectionMerge, "collection-merge", false, "Download the VODs of a collection into a single file along with an ffmetadata file holding a chapter for each VOD. (optional)")
+	fs.BoolVar(&writeInfoJSON, "write-info-json", false, "Write the metadata of the video and of the download to a .info.json file next to the video. (optional)")
+	fs.BoolVar(&writeNFO, "write-nfo", false, "Write the metadata of the video to a Kodi/Jellyfin/Plex .nfo file next to the video. (optional)")
+	fs.BoolVar(&writeThumbnail, "write-thumbnail", false, "Download the thumbnail of the video next to the video. (optional)")
+	fs.BoolVar(&writeChapters, "write-chapters", false, "Write the chapters of a VOD to a .ffmetadata file next to the video and embed them into\n.mp4 and .mkv outputs, remuxed with ffmpeg. (optional)")
+	fs.BoolVar(&unmuted, "unmuted", false, "Download the original content of muted segments when it is still available. (optional)")
+	fs.StringVar(&gapFill, "gap-fill", "", "What to do with a segment still failing after -retries: fail the download when empty, download it\nfrom the next best quality with \"variant\" or leave it out with \"skip\", marking\nthe discontinuity in MPEG-TS outputs. Filled gaps are reported. (optional)")
+	fs.StringVar(&cdnHosts, "cdn-hosts", "", "Comma separated alternate CDN hosts serving the segments of VODs with the same paths. Segments are\nspread over the fastest hosts and failing hosts are avoided for 30 seconds. Example: vod-secure.twitch.tv (optional)")
+	limitRate = 0
+	fs.Var(sizeValue{&limitRate}, "limit-rate", "Maximum bandwidth in bytes per second shared by every download such as 2MB. 0 means no limit.\nSending SIGHUP reloads it from the config file and the environment, the command line value applies when neither sets it. (optional)")
+	fs.IntVar(&retries, "retries", 3, "Number of times the download of a segment is retried before failing. (optional)")
+	fs.DurationVar(&retryDelay, "retry-delay", time.Second, "Delay before the first retry of a segment. It doubles at each attempt. (optional)")
 }
 
 func main() {
+	err := dispatch(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if errors.Cause(err) == errSkipped {
+		fmt.Fprintf(os.Stderr, "Skipped: %v\n", err)
+		return
+	}
 	errVerb := "%v"
 	if verbose {
 		errVerb = "%+v"
 	}
-	if err := run(); err != nil {
+	if err != nil {
+		if jsonOutput && len(batch) == 0 {
+			emitError(url, err)
+		}
+		if len(trace) > 0 {
+			if err := writeTrace(trace, err); err != nil {
+				log.Printf(errVerb, err)
+			}
+		}
 		log.Fatalf(errVerb, err)
 	}
 }
 
-func run() error {
+// dispatch runs the command named by the first argument, or the flat flags
+// when there is no command.
+func dispatch(args []string) error {
+	if len(args) > 0 {
+		if c := findCommand(args[0]); c != nil {
+			fs := c.flagSet()
+			if err := loadConfig(fs, configPath(), os.Getenv); err != nil {
+				return err
+			}
+			if err := fs.Parse(args[1:]); err != nil {
+				return err
+			}
+			if err := setup(!c.local && usesAPI(fs.Args())); err != nil {
+				return err
+			}
+			return c.run(fs.Args())
+		}
+	}
+	if err := loadConfig(flag.CommandLine, configPath(), os.Getenv); err != nil {
+		return err
+	}
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
+	}
+	if err := setup((len(url) > 0 && usesAPI([]string{url})) || len(batch) > 0); err != nil {
+		return err
+	}
+	return run()
+}
+
+// usesAPI reports whether the twitch API is needed for args, that is unless
+// every argument is an HLS playlist.
+func usesAPI(args []string) bool {
+	for _, arg := range args {
+		if !twitchdl.IsPlaylist(arg) {
+			return true
+		}
+	}
+	return len(args) == 0
+}
+
+// setup applies the global flags. api is true when the twitch API is used.
+func setup(api bool) error {
 	if len(clientID) > 0 {
 		defaultClientID = clientID
 	}
 
-	if len(defaultClientID) == 0 {
-		panic("no default client id specified")
+	if api && len(defaultClientID) == 0 {
+		return errors.Errorf("No twitch.tv client ID configured. Use the -client-id flag, the TWITCHDL_CLIENT_ID environment variable or client_id in %s", configPath())
 	}
 
-	if len(url) == 0 {
-		flag.PrintDefaults()
-		return nil
+	if output == stdout {
+		if writeInfoJSON || writeNFO || writeThumbnail || writeChapters {
+			return errors.New("Sidecar files cannot be written when the video is written to stdout")
+		}
+		// Keep stdout for the video.
+		eventsW = os.Stderr
 	}
 
-	name, err := twitchdl.Name(context.Background(), http.DefaultClient, defaultClientID, url)
+	transport := newTransport()
+	if len(proxy) > 0 {
+		u, err := neturl.Parse(proxy)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid proxy %s", proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	var rt http.RoundTripper = transport
+	if len(oauthToken) > 0 {
+		rt = &authTransport{rt: rt, token: oauthToken}
+	}
+	if rateLimit > 0 {
+		rt = &limitTransport{rt: rt, every: time.Duration(float64(time.Second) / rateLimit)}
+	}
+	httpClient = &http.Client{Transport: rt}
+
+	applyLimits()
+	reloadLimitOnSignal()
+	return nil
+}
+
+// newTransport returns a transport configured like http.DefaultTransport.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// writeTrace writes the trace of err to path if err originates from the twitch API.
+func writeTrace(path string, err error) error {
+	apiErr, ok := errors.Cause(err).(*twitch.Error)
+	if !ok {
+		return nil
+	}
+	b, err := json.MarshalIndent(apiErr.Trace, "", "  ")
 	if err != nil {
-		return errors.Wrapf(err, "Retrieving name for URL %s failed", url)
+		return errors.WithStack(err)
 	}
+	return errors.Wrapf(ioutil.WriteFile(path, b, 0666), "Writing trace to %s failed", path)
+}
 
-	if len(quality) == 0 {
-		qualities, err := twitchdl.Qualities(context.Background(), http.DefaultClient, defaultClientID, url)
+// run runs the flat flags.
+func run() error {
+	if len(batch) > 0 {
+		if len(url) > 0 {
+			return errors.New("-url and -a cannot be used together")
+		}
+		jobs, err := readBatch(batch)
 		if err != nil {
-			return errors.Wrapf(err, "Retrieving qualities for URL %s failed", url)
+			return err
 		}
-		fmt.Printf("%s\n%s\n", name, strings.Join(qualities, "\n"))
+		return runJobs(jobs)
+	}
+
+	if len(url) == 0 {
+		flag.Usage()
 		return nil
 	}
-	if quality == "best" {
-		qualities, err := twitchdl.Qualities(context.Background(), http.DefaultClient, defaultClientID, url)
-		if err != nil || len(qualities) == 0 {
-			return errors.Wrapf(err, "Retrieving qualities for URL %s failed", url)
-		}
-		quality = qualities[0]
+
+	j := job{url: url, quality: quality, start: start, end: end, duration: duration, ranges: ranges, output: output, progress: true}
+	return j.run()
+}
+
+// usage prints the commands and the flat flags.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: twitchdl <command> [flags] [arguments]\n       twitchdl [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.short)
 	}
+	fmt.Fprintf(w, "\nRun \"twitchdl help <command>\" for the flags of a command.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
 
-	download, err := twitchdl.Download(context.Background(), http.DefaultClient, defaultClientID, url, quality, start, end)
+// timestampVar defines a flag parsed by twitchdl.ParseTimestamp.
+func timestampVar(fs *flag.FlagSet, p *time.Duration, name, usage string) {
+	*p = 0
+	fs.Var(timestampValue{p}, name, usage)
+}
+
+type timestampValue struct {
+	d *time.Duration
+}
+
+func (t timestampValue) String() string {
+	if t.d == nil || *t.d == 0 {
+		return ""
+	}
+	return t.d.String()
+}
+
+func (t timestampValue) Set(s string) error {
+	d, err := twitchdl.ParseTimestamp(s)
 	if err != nil {
-		return errors.Wrapf(err, "Retrieving stream for URL %s failed", url)
+		return err
 	}
+	*t.d = d
+	return nil
+}
 
-	path, filename := filepath.Split(output)
-	if len(filename) == 0 {
-		ext := "ts"
-		if strings.Contains(strings.ToLower(quality), "audio") {
-			ext = "aac"
-		}
-		filename = fmt.Sprintf("%s (%s).%s", name, quality, ext)
+// sizeValue is a flag of a size in bytes such as "4GiB" or "500MB".
+type sizeValue struct {
+	n *int64
+}
+
+func (v sizeValue) String() string {
+	if v.n == nil || *v.n == 0 {
+		return ""
 	}
-	output = filepath.Join(path, filename)
+	return strconv.FormatInt(*v.n, 10)
+}
 
-	f, err := os.OpenFile(output, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+func (v sizeValue) Set(s string) error {
+	n, err := parseSize(s)
 	if err != nil {
-		return errors.Wrapf(err, "Cannot create file %s", output)
+		return err
+	}
+	*v.n = n
+	return nil
+}
+
+var sizeUnits = map[string]int64{
+	"": 1, "B": 1,
+	"K": 1 << 10, "KB": 1000, "KIB": 1 << 10,
+	"M": 1 << 20, "MB": 1000 * 1000, "MIB": 1 << 20,
+	"G": 1 << 30, "GB": 1000 * 1000 * 1000, "GIB": 1 << 30,
+	"T": 1 << 40, "TB": 1000 * 1000 * 1000 * 1000, "TIB": 1 << 40,
+}
+
+// parseSize parses a size in bytes such as "4GiB", "500MB", "1.5G" or "1024".
+func parseSize(s string) (int64, error) {
+	t := strings.TrimSpace(s)
+	i := strings.IndexFunc(t, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(t)
+	}
+	n, err := strconv.ParseFloat(t[:i], 64)
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(t[i:]))]
+	if err != nil || !ok || n < 0 {
+		return 0, errors.Errorf("invalid size %q", s)
 	}
+	return int64(n * float64(unit)), nil
+}
 
-	fmt.Printf("Downloading: %s\n", f.Name())
+// rangesValue is a repeatable flag of ranges such as "1:00:00-1:05:00".
+type rangesValue struct {
+	ranges *[]twitchdl.Range
+}
 
-	if _, err := io.Copy(f, &reader{r: download}); err != nil {
-		return errors.Wrapf(err, "Writing to file %s failed", output)
+func (r rangesValue) String() string {
+	if r.ranges == nil {
+		return ""
 	}
-	if err := f.Close(); err != nil {
-		return errors.Wrapf(err, "Closing file %s failed", output)
+	var s []string
+	for _, rg := range *r.ranges {
+		s = append(s, rg.Start.String()+"-"+rg.End.String())
 	}
-	fmt.Printf("\rDone%-25s\n", " ")
+	return strings.Join(s, ",")
+}
+
+func (r rangesValue) Set(s string) error {
+	rg, err := parseRange(s)
+	if err != nil {
+		return err
+	}
+	*r.ranges = append(*r.ranges, rg)
 	return nil
 }
 
-// reader prints the download progress every second.
+// parseRange parses "start-end" where start and end are timestamps that can
+// be negative such as "-20m--10m". An empty end means the end of the VOD.
+func parseRange(s string) (twitchdl.Range, error) {
+	// The first character is the sign of start or the start itself.
+	i := -1
+	if len(s) > 0 {
+		i = strings.Index(s[1:], "-")
+	}
+	if i < 0 {
+		return twitchdl.Range{}, errors.Errorf("invalid range %q, expected start-end", s)
+	}
+	i++
+	start, err := twitchdl.ParseTimestamp(s[:i])
+	if err != nil {
+		return twitchdl.Range{}, err
+	}
+	var end time.Duration
+	if e := s[i+1:]; len(e) > 0 {
+		if end, err = twitchdl.ParseTimestamp(e); err != nil {
+			return twitchdl.Range{}, err
+		}
+	}
+	return twitchdl.Range{Start: start, End: end}, nil
+}
+
+// reader prints the download progress to stderr every second.
 type reader struct {
 	r io.Reader
 
@@ -129,7 +424,7 @@ func (r *reader) Read(p []byte) (n int, err error) {
 	r.n += uint64(n)
 	r.t += uint64(n)
 	if time.Since(r.from) > time.Second {
-		fmt.Printf("\r%-12s %-10s",
+		fmt.Fprintf(os.Stderr, "\r%-12s %-10s",
 			r.btos(r.bitrate())+"/s",
 			r.btos(r.t))
 		r.from = time.Now()
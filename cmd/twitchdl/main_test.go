@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected twitchdl.Range
+		err      bool
+	}{
+		{input: "1:00:00-1:05:00", expected: twitchdl.Range{Start: time.Hour, End: time.Hour + 5*time.Minute}},
+		{input: "90-120", expected: twitchdl.Range{Start: 90 * time.Second, End: 2 * time.Minute}},
+		{input: "-20m--10m", expected: twitchdl.Range{Start: -20 * time.Minute, End: -10 * time.Minute}},
+		{input: "1h-", expected: twitchdl.Range{Start: time.Hour}},
+		{input: "", err: true},
+		{input: "1h", err: true},
+		{input: "a-b", err: true},
+	}
+	for _, tc := range tcs {
+		actual, err := parseRange(tc.input)
+		if tc.err {
+			assert.Error(t, err, tc.input)
+			continue
+		}
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, actual, tc.input)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected int64
+		err      bool
+	}{
+		{input: "1024", expected: 1024},
+		{input: "4GiB", expected: 4 << 30},
+		{input: "4G", expected: 4 << 30},
+		{input: "500MB", expected: 500 * 1000 * 1000},
+		{input: "1.5 kib", expected: 1536},
+		{input: "", err: true},
+		{input: "GB", err: true},
+		{input: "4XB", err: true},
+	}
+	for _, tc := range tcs {
+		actual, err := parseSize(tc.input)
+		if tc.err {
+			assert.Error(t, err, tc.input)
+			continue
+		}
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, tc.expected, actual, tc.input)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/pkg/errors"
+)
+
+// serveJob is a download queued through the HTTP API.
+type serveJob struct {
+	ID       int    `json:"id"`
+	URL      string `json:"url"`
+	Quality  string `json:"quality,omitempty"`
+	Start    string `json:"start,omitempty"`
+	End      string `json:"end,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Output   string `json:"output,omitempty"`
+	// Status is one of queued, running, succeeded or failed.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// path is Output resolved inside the root directory of the server.
+	path string
+}
+
+// serveLimit is the bandwidth limit set through the HTTP API.
+type serveLimit struct {
+	Rate int64 `json:"rate"`
+}
+
+// server queues the downloads requested through its HTTP API:
+//
+//	POST /downloads       queues the download described by a JSON serveJob
+//	GET  /downloads       lists the downloads
+//	GET  /downloads/<id>  describes a download
+//	GET  /limit           returns the bandwidth limit as {"rate": <bytes per second>}
+//	PUT  /limit           sets the bandwidth limit, 0 meaning no limit
+//
+// Every request must hold the token of the server in an Authorization
+// header and the bodies must be sent as application/json, which web pages
+// cannot do without the server allowing it. Outputs are written inside the
+// root directory.
+type server struct {
+	token string
+	root  string
+	mu    sync.Mutex
+	jobs  []*serveJob
+	queue chan *serveJob
+	// run runs a job, it is replaced in tests.
+	run func(j job) error
+}
+
+func newServer(token, root string) *server {
+	return &server{token: token, root: root, queue: make(chan *serveJob, 1024), run: job.run}
+}
+
+func runServe(args []string) error {
+	if _, err := resolveOutput(serveRoot, output); err != nil {
+		return errors.Wrap(err, "Invalid -o")
+	}
+	token := serveToken
+	if len(token) == 0 {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return errors.WithStack(err)
+		}
+		token = hex.EncodeToString(b)
+		log.Printf("Token: %s", token)
+	}
+	s := newServer(token, serveRoot)
+	n := concurrency
+	if n < 1 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		go s.work()
+	}
+	log.Printf("Listening on %s", addr)
+	return errors.WithStack(http.ListenAndServe(addr, s))
+}
+
+// work runs the queued jobs.
+func (s *server) work() {
+	for sj := range s.queue {
+		s.mu.Lock()
+		j := batchDefaults()
+		j.url = sj.URL
+		if len(sj.Quality) > 0 {
+			j.quality = sj.Quality
+		}
+		j.output = sj.path
+		j.start, _ = parseTimestamp(sj.Start)
+		j.end, _ = parseTimestamp(sj.End)
+		j.duration, _ = parseTimestamp(sj.Duration)
+		sj.Status = "running"
+		s.mu.Unlock()
+
+		err := s.run(j)
+
+		s.mu.Lock()
+		sj.Status = "succeeded"
+		if err != nil {
+			sj.Status = "failed"
+			sj.Error = err.Error()
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || t != "application/json" {
+			http.Error(w, "expected Content-Type application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	switch {
+	case r.URL.Path == "/downloads" && r.Method == http.MethodPost:
+		s.create(w, r)
+	case r.URL.Path == "/downloads" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, s.jobs)
+	case r.URL.Path == "/limit" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, serveLimit{Rate: limiter.Rate()})
+	case r.URL.Path == "/limit" && r.Method == http.MethodPut:
+		var l serveLimit
+		if err := json.NewDecoder(r.Body).Decode(&l); err != nil || l.Rate < 0 {
+			http.Error(w, "expected {\"rate\": <bytes per second>}", http.StatusBadRequest)
+			return
+		}
+		limiter.SetRate(l.Rate)
+		writeJSON(w, http.StatusOK, l)
+	case strings.HasPrefix(r.URL.Path, "/downloads/") && r.Method == http.MethodGet:
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/downloads/"))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil || id < 1 || id > len(s.jobs) {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.jobs[id-1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// remoteURL reports whether u is an http or https URL. Local playlists and
+// file:// URLs are refused so that clients cannot read the files of the
+// server.
+func remoteURL(u string) bool {
+	parsed, err := neturl.Parse(u)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && len(parsed.Host) > 0
+}
+
+func (s *server) create(w http.ResponseWriter, r *http.Request) {
+	var sj serveJob
+	if err := json.NewDecoder(r.Body).Decode(&sj); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(sj.URL) == 0 {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return
+	}
+	if !remoteURL(sj.URL) {
+		http.Error(w, "url must be a twitch or HTTP(S) URL", http.StatusBadRequest)
+		return
+	}
+	for _, t := range []string{sj.Start, sj.End, sj.Duration} {
+		if _, err := parseTimestamp(t); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	o := sj.Output
+	if len(o) == 0 {
+		o = output
+	}
+	path, err := resolveOutput(s.root, o)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sj.path = path
+	s.mu.Lock()
+	sj.ID = len(s.jobs) + 1
+	sj.Status = "queued"
+	sj.Error = ""
+	s.jobs = append(s.jobs, &sj)
+	resp := sj
+	s.mu.Unlock()
+	select {
+	case s.queue <- &sj:
+	default:
+		s.mu.Lock()
+		sj.Status = "failed"
+		sj.Error = "queue is full"
+		resp = sj
+		s.mu.Unlock()
+	}
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// resolveOutput resolves output inside root. Absolute outputs and outputs
+// holding ".." are rejected so that they cannot escape root.
+func resolveOutput(root, output string) (string, error) {
+	if output == stdout {
+		return "", errors.New("output cannot be stdout")
+	}
+	if filepath.IsAbs(output) || len(filepath.VolumeName(output)) > 0 || strings.HasPrefix(output, "/") || strings.HasPrefix(output, `\`) {
+		return "", errors.Errorf("output %s must be relative", output)
+	}
+	for _, elem := range strings.FieldsFunc(output, isSlash) {
+		if elem == ".." {
+			return "", errors.Errorf("output %s cannot contain \"..\"", output)
+		}
+	}
+	path := filepath.Join(root, output)
+	if len(output) == 0 || isSlash(rune(output[len(output)-1])) {
+		// Keep outputs designating a directory as such.
+		path += string(filepath.Separator)
+	}
+	return path, nil
+}
+
+func isSlash(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+// parseTimestamp parses an optional timestamp.
+func parseTimestamp(s string) (time.Duration, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	return twitchdl.ParseTimestamp(s)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
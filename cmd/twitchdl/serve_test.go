@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveRequest sends an authorized JSON request to s.
+func serveRequest(s *server, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServer(t *testing.T) {
+	s := newServer("secret", "downloads")
+	ran := make(chan job, 2)
+	s.run = func(j job) error {
+		ran <- j
+		if j.quality == "720p30" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	post := func(body string) (int, serveJob) {
+		rec := serveRequest(s, http.MethodPost, "/downloads", body)
+		var sj serveJob
+		json.Unmarshal(rec.Body.Bytes(), &sj)
+		return rec.Code, sj
+	}
+
+	code, _ := post(`{"quality":"best"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = post(`{"url":"https://www.twitch.tv/videos/1","start":"soon"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = post(`{"url":"https://www.twitch.tv/videos/1","output":"../video.ts"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	for _, source := range []string{"/etc/video.m3u8", "video.m3u8", "file:///etc/video.m3u8", "FILE:///etc/video.m3u8", `C:\\video.m3u8`, "https:///video.m3u8"} {
+		body, _ := json.Marshal(map[string]string{"url": source})
+		code, _ = post(string(body))
+		assert.Equal(t, http.StatusBadRequest, code, source)
+	}
+
+	code, sj := post(`{"url":"https://www.twitch.tv/videos/1","start":"1h","end":"2h","output":"{login}/"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, serveJob{ID: 1, URL: "https://www.twitch.tv/videos/1", Start: "1h", End: "2h", Output: "{login}/", Status: "queued"}, sj)
+	_, sj = post(`{"url":"https://www.twitch.tv/videos/2","quality":"720p30"}`)
+	assert.Equal(t, 2, sj.ID)
+
+	go s.work()
+	defer close(s.queue)
+	j := <-ran
+	assert.Equal(t, "https://www.twitch.tv/videos/1", j.url)
+	assert.Equal(t, time.Hour, j.start)
+	assert.Equal(t, 2*time.Hour, j.end)
+	assert.Equal(t, filepath.Join("downloads", "{login}")+string(filepath.Separator), j.output)
+	j = <-ran
+	assert.Equal(t, "downloads"+string(filepath.Separator), j.output)
+
+	get := func(path string) (int, []byte) {
+		rec := serveRequest(s, http.MethodGet, path, "")
+		return rec.Code, rec.Body.Bytes()
+	}
+	require.Eventually(t, func() bool {
+		_, b := get("/downloads/2")
+		return strings.Contains(string(b), `"status":"failed"`)
+	}, time.Second, 10*time.Millisecond)
+
+	code, b := get("/downloads")
+	assert.Equal(t, http.StatusOK, code)
+	var jobs []serveJob
+	require.NoError(t, json.Unmarshal(b, &jobs))
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "succeeded", jobs[0].Status)
+	assert.Equal(t, "boom", jobs[1].Error)
+
+	code, _ = get("/downloads/3")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestServerLimit(t *testing.T) {
+	defer limiter.SetRate(0)
+	s := newServer("secret", ".")
+
+	rec := serveRequest(s, http.MethodPut, "/limit", `{"rate":2000000}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int64(2000000), limiter.Rate())
+
+	rec = serveRequest(s, http.MethodGet, "/limit", "")
+	assert.JSONEq(t, `{"rate":2000000}`, rec.Body.String())
+
+	rec = serveRequest(s, http.MethodPut, "/limit", `{"rate":-1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestServerAuth(t *testing.T) {
+	defer limiter.SetRate(0)
+	s := newServer("secret", ".")
+	s.run = func(j job) error {
+		t.Errorf("unexpected download %s", j.url)
+		return nil
+	}
+
+	for _, tc := range []struct {
+		name, method, path, authorization, contentType string
+		code                                           int
+	}{
+		{"no token", http.MethodGet, "/downloads", "", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "/downloads", "Bearer nope", "application/json", http.StatusUnauthorized},
+		{"no token limit", http.MethodPut, "/limit", "", "application/json", http.StatusUnauthorized},
+		{"form", http.MethodPost, "/downloads", "Bearer secret", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"plain limit", http.MethodPut, "/limit", "Bearer secret", "text/plain", http.StatusUnsupportedMediaType},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"url":"https://www.twitch.tv/videos/1","rate":1}`))
+			if len(tc.authorization) > 0 {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			req.Header.Set("Content-Type", tc.contentType)
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.code, rec.Code)
+		})
+	}
+	assert.Empty(t, s.jobs)
+	assert.Equal(t, int64(0), limiter.Rate())
+}
+
+func TestResolveOutput(t *testing.T) {
+	sep := string(filepath.Separator)
+	for _, tc := range []struct {
+		output, expected string
+	}{
+		{"", "root" + sep},
+		{"video.ts", filepath.Join("root", "video.ts")},
+		{"{login}/{title}.{ext}", filepath.Join("root", "{login}", "{title}.{ext}")},
+		{"channel/", filepath.Join("root", "channel") + sep},
+		{"a..b.ts", filepath.Join("root", "a..b.ts")},
+	} {
+		path, err := resolveOutput("root", tc.output)
+		require.NoError(t, err, tc.output)
+		assert.Equal(t, tc.expected, path, tc.output)
+	}
+	for _, output := range []string{"-", "/etc/passwd", `\\server\share\x.ts`, "../x.ts", "a/../../x.ts", `a\..\x.ts`, "{login}/.."} {
+		_, err := resolveOutput("root", output)
+		assert.Error(t, err, output)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	twitchdl "github.com/jybp/twitch-downloader"
+	"github.com/pkg/errors"
+)
+
+// writeSidecars writes the files requested by the sidecar flags next to the
+// video downloaded at path.
+func writeSidecars(path string, meta twitchdl.Metadata, info *twitchdl.Info, startedAt time.Time) error {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	if writeInfoJSON {
+		sidecar := twitchdl.NewSidecar(meta, info, version, startedAt, time.Now())
+		if err := createFile(base+".info.json", func(w io.Writer) error {
+			return twitchdl.WriteInfoJSON(w, sidecar)
+		}); err != nil {
+			return err
+		}
+	}
+	if writeNFO {
+		if err := createFile(base+".nfo", func(w io.Writer) error {
+			return twitchdl.WriteNFO(w, meta)
+		}); err != nil {
+			return err
+		}
+	}
+	if writeChapters && meta.VOD != nil && info != nil {
+		if err := writeVODChapters(path, meta, *info); err != nil {
+			return err
+		}
+	}
+	if writeThumbnail {
+		thumbnail, ext, err := twitchdl.Thumbnail(context.Background(), httpClient, meta)
+		if err != nil {
+			return errors.Wrap(err, "Retrieving thumbnail failed")
+		}
+		defer thumbnail.Close()
+		if err := createFile(base+ext, func(w io.Writer) error {
+			_, err := io.Copy(w, thumbnail)
+			return errors.WithStack(err)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createFile creates a new file at path whose content is written by write.
+// An existing file is replaced only if the -on-exist policy is overwrite.
+func createFile(path string, write func(w io.Writer) error) error {
+	flags := os.O_RDWR | os.O_CREATE | os.O_EXCL
+	if onExist == "overwrite" {
+		flags = os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot create file %s", path)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "Writing to file %s failed", path)
+	}
+	return errors.Wrapf(f.Close(), "Closing file %s failed", path)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// authTransport authenticates the requests to the twitch API with an OAuth
+// token. Requests to other hosts such as the CDN are left untouched so that
+// the token never leaks.
+type authTransport struct {
+	rt    http.RoundTripper
+	token string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "gql.twitch.tv" {
+		return t.rt.RoundTrip(req)
+	}
+	req = cloneRequest(req)
+	req.Header.Set("Authorization", "OAuth "+t.token)
+	return t.rt.RoundTrip(req)
+}
+
+// cloneRequest returns a shallow copy of req whose headers can be modified.
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	return r
+}
+
+// limitTransport spaces requests by at least every.
+type limitTransport struct {
+	rt    http.RoundTripper
+	every time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	wait := t.next.Sub(now)
+	t.next = t.next.Add(t.every)
+	t.mu.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	return t.rt.RoundTrip(req)
+}
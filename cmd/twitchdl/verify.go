@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const tsPacketSize = 188
+
+func runVerify(args []string) error {
+	if len(args) == 0 {
+		return errors.New("verify expects at least one file")
+	}
+	var failed int
+	for _, path := range args {
+		if err := verifyFile(path); err != nil {
+			failed++
+			fmt.Printf("FAILED  %s: %v\n", path, err)
+			continue
+		}
+		fmt.Printf("OK      %s\n", path)
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d files are corrupted", failed, len(args))
+	}
+	return nil
+}
+
+func verifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot open file %s", path)
+	}
+	defer f.Close()
+	return verify(f)
+}
+
+// verify checks the structure of the MPEG-TS or MP4 content of r.
+func verify(r io.ReadSeeker) error {
+	head := make([]byte, 8)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return errors.WithStack(err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return errors.WithStack(err)
+	}
+	switch {
+	case n > 0 && head[0] == 0x47:
+		return verifyTS(r)
+	case n == 8 && bytes.Equal(head[4:8], []byte("ftyp")):
+		return verifyMP4(r)
+	}
+	return errors.New("unknown format, expected MPEG-TS or MP4")
+}
+
+// verifyTS checks that r is made of whole 188 bytes packets each starting
+// with the sync byte.
+func verifyTS(r io.Reader) error {
+	p := make([]byte, tsPacketSize)
+	for offset := int64(0); ; offset += tsPacketSize {
+		n, err := io.ReadFull(r, p)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == io.ErrUnexpectedEOF:
+			return errors.Errorf("truncated packet of %d bytes at offset %d", n, offset)
+		case err != nil:
+			return errors.WithStack(err)
+		case p[0] != 0x47:
+			return errors.Errorf("missing sync byte at offset %d", offset)
+		}
+	}
+}
+
+// verifyMP4 checks that r is a sequence of whole top level boxes including
+// the ftyp and moov boxes.
+func verifyMP4(r io.ReadSeeker) error {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	seen := map[string]bool{}
+	header := make([]byte, 16)
+	for offset := int64(0); offset < end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return errors.Errorf("truncated box header at offset %d", offset)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return errors.Errorf("truncated box header at offset %d", offset)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 || offset+size > end {
+			return errors.Errorf("box %q at offset %d overflows the file", typ, offset)
+		}
+		seen[typ] = true
+		offset += size
+	}
+	for _, typ := range []string{"ftyp", "moov"} {
+		if !seen[typ] {
+			return errors.Errorf("missing %s box", typ)
+		}
+	}
+	return nil
+}
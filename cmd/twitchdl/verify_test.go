@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func box(typ string, size int) []byte {
+	b := make([]byte, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	return b
+}
+
+func TestVerify(t *testing.T) {
+	packet := append([]byte{0x47}, make([]byte, tsPacketSize-1)...)
+	ts := bytes.Repeat(packet, 3)
+	badSync := append(append([]byte{}, packet...), make([]byte, tsPacketSize)...)
+	mp4 := append(append(box("ftyp", 16), box("moov", 24)...), box("mdat", 16)...)
+
+	tcs := []struct {
+		name  string
+		input []byte
+		err   string
+	}{
+		{name: "ts", input: ts},
+		{name: "truncated ts", input: ts[:len(ts)-10], err: "truncated packet of 178 bytes at offset 376"},
+		{name: "bad sync", input: badSync, err: "missing sync byte at offset 188"},
+		{name: "mp4", input: mp4},
+		{name: "truncated mp4", input: mp4[:len(mp4)-4], err: `box "mdat" at offset 40 overflows the file`},
+		{name: "no moov", input: box("ftyp", 16), err: "missing moov box"},
+		{name: "unknown", input: []byte("hello"), err: "unknown format, expected MPEG-TS or MP4"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verify(bytes.NewReader(tc.input))
+			if len(tc.err) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
@@ -3,10 +3,12 @@ module github.com/jybp/twitch-downloader
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/pkg/errors v0.8.1
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/text v0.3.8
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
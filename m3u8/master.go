@@ -45,6 +45,7 @@ type Variant struct {
 	// Optional
 	Codecs       []string
 	Resolution   Resolution
+	FrameRate    float64
 	Video        string
 	Audio        string
 	Alternatives []Alternative
@@ -70,7 +71,7 @@ func attributes(line string) (map[string]string, error) {
 	list := strings.FieldsFunc(line, fn)
 	attr := map[string]string{}
 	for _, it := range list {
-		kv := strings.Split(it, "=")
+		kv := strings.SplitN(it, "=", 2)
 		if len(kv) != 2 {
 			return attr, errors.New("malformed attribute")
 		}
@@ -118,6 +119,13 @@ func Master(r io.Reader) (MasterPlaylist, error) {
 			resolution, _ := attr["RESOLUTION"]
 			fmt.Sscanf(resolution, "%dx%d", &variant.Resolution.Width, &variant.Resolution.Height)
 
+			if frameRate, ok := attr["FRAME-RATE"]; ok {
+				variant.FrameRate, err = strconv.ParseFloat(frameRate, 64)
+				if err != nil {
+					return playlist, errors.WithStack(err)
+				}
+			}
+
 			variant.Video, _ = attr["VIDEO"]
 			variant.Audio, _ = attr["AUDIO"]
 
@@ -13,7 +13,7 @@ func TestMaster(t *testing.T) {
 	b := []byte(`#EXTM3U
 #EXT-X-EXAMPLE-INFO:ORIGIN="origin"
 #EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="chunked",NAME="1080p",AUTOSELECT=YES,DEFAULT=YES
-#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=6847192,CODECS="avc1.42C028,mp4a.40.2",RESOLUTION="1920x1080",VIDEO="chunked"
+#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=6847192,CODECS="avc1.42C028,mp4a.40.2",RESOLUTION="1920x1080",VIDEO="chunked",FRAME-RATE=59.940
 http://example.com/chunked/index-dvr.m3u8
 #EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="720p30",NAME="720p"
 #EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=2303475,CODECS="avc1.4D401F,mp4a.40.2",RESOLUTION="1280x720",VIDEO="720p30"
@@ -35,6 +35,7 @@ http://example.com/720p30/index-dvr.m3u8`)
 	assert.Equal(t, "mp4a.40.2", playlist.Variants[0].Codecs[1])
 	assert.Equal(t, 1920, playlist.Variants[0].Resolution.Width)
 	assert.Equal(t, 1080, playlist.Variants[0].Resolution.Height)
+	assert.Equal(t, 59.94, playlist.Variants[0].FrameRate)
 	assert.Equal(t, "chunked", playlist.Variants[0].Video)
 	assert.Equal(t, 1, len(playlist.Variants[0].Alternatives))
 	assert.Equal(t, "VIDEO", playlist.Variants[0].Alternatives[0].Type)
@@ -50,6 +51,7 @@ http://example.com/720p30/index-dvr.m3u8`)
 	assert.Equal(t, "mp4a.40.2", playlist.Variants[1].Codecs[1])
 	assert.Equal(t, 1280, playlist.Variants[1].Resolution.Width)
 	assert.Equal(t, 720, playlist.Variants[1].Resolution.Height)
+	assert.Equal(t, float64(0), playlist.Variants[1].FrameRate)
 	assert.Equal(t, "720p30", playlist.Variants[1].Video)
 	assert.Equal(t, 1, len(playlist.Variants[1].Alternatives))
 	assert.Equal(t, "VIDEO", playlist.Variants[1].Alternatives[0].Type)
@@ -2,6 +2,8 @@ package m3u8
 
 import (
 	"bufio"
+	"encoding/binary"
+	"encoding/hex"
 	"io"
 	"net/url"
 	"path"
@@ -19,6 +21,23 @@ type MediaSegment struct {
 	Number   int
 	Duration time.Duration
 	URL      string
+	// Muted reports whether the audio of the segment has been muted, Twitch
+	// replaces the URLs of such segments with "-muted.ts" URLs.
+	Muted bool
+	// Key is nil unless the segment is encrypted.
+	Key *Key
+}
+
+// Key describes how to decrypt a Media Segment.
+//
+// https://tools.ietf.org/html/rfc8216#section-4.3.2.4
+type Key struct {
+	// Method is the encryption method such as "AES-128".
+	Method string
+	URI    string
+	// IV is the 128-bit initialization vector. It defaults to the Media
+	// Sequence Number of the segment.
+	IV []byte
 }
 
 // MediaPlaylist contains a series of Media Segments that make up the
@@ -58,6 +77,7 @@ func Media(r io.Reader, URL string) (MediaPlaylist, error) {
 
 	playlist := MediaPlaylist{}
 	var segmentIndex = 0
+	var key *Key
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -84,6 +104,14 @@ func Media(r io.Reader, URL string) (MediaPlaylist, error) {
 			continue
 		}
 
+		if strings.HasPrefix(line, "#EXT-X-KEY:") {
+			var err error
+			if key, err = parseKey(line[11:], baseURL); err != nil {
+				return playlist, err
+			}
+			continue
+		}
+
 		if strings.HasPrefix(line, "#EXTINF:") {
 			segment := MediaSegment{}
 			segment.Number = playlist.Sequence + segmentIndex
@@ -103,6 +131,15 @@ func Media(r io.Reader, URL string) (MediaPlaylist, error) {
 				return playlist, errors.WithStack(io.ErrUnexpectedEOF)
 			}
 			segment.URL = scanner.Text()
+			segment.Muted = strings.HasSuffix(strings.SplitN(segment.URL, "?", 2)[0], "-muted.ts")
+			if key != nil {
+				k := *key
+				if k.IV == nil {
+					k.IV = make([]byte, 16)
+					binary.BigEndian.PutUint64(k.IV[8:], uint64(segment.Number))
+				}
+				segment.Key = &k
+			}
 			if baseURL != nil {
 				segmentURL, err := url.Parse(segment.URL)
 				if err != nil {
@@ -127,3 +164,40 @@ func Media(r io.Reader, URL string) (MediaPlaylist, error) {
 
 	return playlist, errors.WithStack(scanner.Err())
 }
+
+// parseKey parses the attributes of an EXT-X-KEY tag. It returns nil for
+// the NONE method.
+func parseKey(line string, baseURL *url.URL) (*Key, error) {
+	attr, err := attributes(line)
+	if err != nil {
+		return nil, err
+	}
+	method := attr["METHOD"]
+	switch method {
+	case "NONE":
+		return nil, nil
+	case "":
+		return nil, errors.New("EXT-X-KEY without METHOD")
+	}
+	key := &Key{Method: method, URI: attr["URI"]}
+	if len(key.URI) == 0 {
+		return nil, errors.New("EXT-X-KEY without URI")
+	}
+	if baseURL != nil {
+		keyURL, err := url.Parse(key.URI)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		key.URI = baseURL.ResolveReference(keyURL).String()
+	}
+	if iv, ok := attr["IV"]; ok {
+		iv = strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X")
+		b, err := hex.DecodeString(iv)
+		if err != nil || len(b) > 16 {
+			return nil, errors.Errorf("invalid IV %s", attr["IV"])
+		}
+		key.IV = make([]byte, 16)
+		copy(key.IV[16-len(b):], b)
+	}
+	return key, nil
+}
@@ -45,3 +45,59 @@ http://custom.com/720p30/1.ts?query=val
 	assert.Equal(t, 3, playlist.Segments[1].Number)
 	assert.Equal(t, "http://custom.com/720p30/1.ts?query=val", playlist.Segments[1].URL)
 }
+
+func TestMediaMuted(t *testing.T) {
+	b := []byte(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+0.ts
+#EXTINF:10,
+1-muted.ts?query=val
+#EXTINF:10,
+2-unmuted.ts
+#EXT-X-ENDLIST`)
+	playlist, err := m3u8.Media(bytes.NewReader(b), "http://example.com/720p30/index-dvr.m3u8")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal(t, 3, len(playlist.Segments))
+	assert.False(t, playlist.Segments[0].Muted)
+	assert.Equal(t, "http://example.com/720p30/1-muted.ts?query=val", playlist.Segments[1].URL)
+	assert.True(t, playlist.Segments[1].Muted)
+	assert.False(t, playlist.Segments[2].Muted)
+}
+
+func TestMediaKeys(t *testing.T) {
+	b := []byte(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-KEY:METHOD=AES-128,URI="key?token=a=b"
+#EXTINF:10,
+0.ts
+#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/k2",IV=0x000102030405060708090A0B0C0D0E0F
+#EXTINF:10,
+1.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:10,
+2.ts
+#EXT-X-ENDLIST`)
+	playlist, err := m3u8.Media(bytes.NewReader(b), "http://example.com/720p30/index.m3u8")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal(t, 3, len(playlist.Segments))
+	assert.Equal(t, &m3u8.Key{
+		Method: "AES-128",
+		URI:    "http://example.com/720p30/key?token=a=b",
+		IV:     []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 7},
+	}, playlist.Segments[0].Key)
+	assert.Equal(t, &m3u8.Key{
+		Method: "AES-128",
+		URI:    "https://keys.example.com/k2",
+		IV:     []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	}, playlist.Segments[1].Key)
+	assert.Nil(t, playlist.Segments[2].Key)
+
+	_, err = m3u8.Media(bytes.NewReader([]byte("#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0xZZ\n")), "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package twitch
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+const channelVideosQuery = `query ChannelVideos($login: String!, $type: BroadcastType, $after: Cursor) {
+  user(login: $login) {
+    videos(first: 100, after: $after, type: $type, sort: TIME) {
+      edges { cursor node { ` + vodFields + ` } }
+      pageInfo { hasNextPage }
+    }
+  }
+}`
+
+// ChannelVideos retrieves the VODs of the channel "login", most recent first.
+// An empty broadcastType retrieves every type of VOD. A limit of 0 retrieves
+// every VOD.
+func (c *Client) ChannelVideos(ctx context.Context, login string, broadcastType BroadcastType, limit int) ([]VOD, error) {
+	type payload struct {
+		Data struct {
+			User *struct {
+				Videos struct {
+					Edges []struct {
+						Cursor string    `json:"cursor"`
+						Node   *gqlVideo `json:"node"`
+					} `json:"edges"`
+					PageInfo struct {
+						HasNextPage bool `json:"hasNextPage"`
+					} `json:"pageInfo"`
+				} `json:"videos"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	variables := map[string]interface{}{"login": login}
+	if len(broadcastType) > 0 {
+		variables["type"] = broadcastType
+	}
+	var vods []VOD
+	for {
+		var p payload
+		if err := c.gql(ctx, channelVideosQuery, variables, &p); err != nil {
+			return nil, err
+		}
+		if p.Data.User == nil {
+			return nil, errors.Wrapf(ErrNotFound, "channel %s", login)
+		}
+		videos := p.Data.User.Videos
+		for _, edge := range videos.Edges {
+			variables["after"] = edge.Cursor
+			if edge.Node == nil {
+				continue
+			}
+			vods = append(vods, edge.Node.vod())
+			if limit > 0 && len(vods) >= limit {
+				return vods, nil
+			}
+		}
+		if !videos.PageInfo.HasNextPage || len(videos.Edges) == 0 {
+			return vods, nil
+		}
+	}
+}
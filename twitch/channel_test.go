@@ -0,0 +1,55 @@
+package twitch_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jybp/twitch-downloader/twitch"
+)
+
+func TestChannelVideos(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]string `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Variables["login"] != "owner" {
+			w.Write([]byte(`{"data":{"user":null}}`))
+			return
+		}
+		assert.Equal(t, "ARCHIVE", req.Variables["type"])
+		if len(req.Variables["after"]) == 0 {
+			w.Write([]byte(`{"data":{"user":{"videos":{"edges":[
+				{"cursor":"c1","node":{"id":"3","status":"RECORDING"}},
+				{"cursor":"c2","node":{"id":"2"}}
+			],"pageInfo":{"hasNextPage":true}}}}}`))
+			return
+		}
+		assert.Equal(t, "c2", req.Variables["after"])
+		w.Write([]byte(`{"data":{"user":{"videos":{"edges":[
+			{"cursor":"c3","node":{"id":"1"}}
+		],"pageInfo":{"hasNextPage":false}}}}}`))
+	}))
+	defer srv.Close()
+	api := twitch.Custom(srv.Client(), "clientID", srv.URL, srv.URL)
+
+	vods, err := api.ChannelVideos(context.Background(), "owner", twitch.BroadcastArchive, 0)
+	require.NoError(t, err)
+	require.Len(t, vods, 3)
+	assert.Equal(t, "3", vods[0].ID)
+	assert.Equal(t, "RECORDING", vods[0].Status)
+	assert.Equal(t, "1", vods[2].ID)
+
+	vods, err = api.ChannelVideos(context.Background(), "owner", twitch.BroadcastArchive, 1)
+	require.NoError(t, err)
+	assert.Len(t, vods, 1)
+
+	_, err = api.ChannelVideos(context.Background(), "unknown", twitch.BroadcastArchive, 0)
+	assert.Error(t, err)
+}
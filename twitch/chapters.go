@@ -0,0 +1,81 @@
+package twitch
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const chaptersQuery = `query VideoChapters($id: ID!) {
+  video(id: $id) {
+    moments(first: 100, momentRequestType: VIDEO_CHAPTER_MARKERS) {
+      edges {
+        node {
+          description
+          positionMilliseconds
+          durationMilliseconds
+          details { ... on GameChangeMomentDetails { game { id name displayName } } }
+        }
+      }
+    }
+  }
+}`
+
+// Chapter is a chapter marker of a VOD, created when the game of the
+// stream changes.
+type Chapter struct {
+	Title                string `json:"description"`
+	Game                 Game   `json:"game"`
+	PositionMilliseconds int    `json:"positionMilliseconds"`
+	DurationMilliseconds int    `json:"durationMilliseconds"`
+}
+
+// Offset returns the position of the chapter in the VOD.
+func (c Chapter) Offset() time.Duration {
+	return time.Duration(c.PositionMilliseconds) * time.Millisecond
+}
+
+// Duration returns the duration of the chapter.
+func (c Chapter) Duration() time.Duration {
+	return time.Duration(c.DurationMilliseconds) * time.Millisecond
+}
+
+// Chapters retrieves the chapters of the VOD "id" in chronological order.
+// VODs of a single game usually have no chapter.
+func (c *Client) Chapters(ctx context.Context, id string) ([]Chapter, error) {
+	var p struct {
+		Data struct {
+			Video *struct {
+				Moments struct {
+					Edges []struct {
+						Node *struct {
+							Chapter
+							Details struct {
+								Game *Game `json:"game"`
+							} `json:"details"`
+						} `json:"node"`
+					} `json:"edges"`
+				} `json:"moments"`
+			} `json:"video"`
+		} `json:"data"`
+	}
+	if err := c.gql(ctx, chaptersQuery, map[string]interface{}{"id": id}, &p); err != nil {
+		return nil, err
+	}
+	if p.Data.Video == nil {
+		return nil, errors.Wrapf(ErrNotFound, "VOD %s", id)
+	}
+	var chapters []Chapter
+	for _, edge := range p.Data.Video.Moments.Edges {
+		if edge.Node == nil {
+			continue
+		}
+		chapter := edge.Node.Chapter
+		if edge.Node.Details.Game != nil {
+			chapter.Game = *edge.Node.Details.Game
+		}
+		chapters = append(chapters, chapter)
+	}
+	return chapters, nil
+}
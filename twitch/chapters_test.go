@@ -0,0 +1,46 @@
+package twitch_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jybp/twitch-downloader/twitch"
+)
+
+func TestChapters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]string `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Variables["id"] != "12345" {
+			w.Write([]byte(`{"data":{"video":null}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"video":{"moments":{"edges":[
+			{"node":{"description":"Just Chatting","positionMilliseconds":0,"durationMilliseconds":600000,"details":{"game":{"id":"1","name":"Just Chatting","displayName":"Just Chatting"}}}},
+			{"node":null},
+			{"node":{"description":"Elden Ring","positionMilliseconds":600000,"durationMilliseconds":3000000,"details":{"game":{"id":"2","name":"ELDEN RING","displayName":"Elden Ring"}}}}
+		]}}}}`))
+	}))
+	defer srv.Close()
+	api := twitch.Custom(srv.Client(), "clientID", srv.URL, srv.URL)
+
+	chapters, err := api.Chapters(context.Background(), "12345")
+	require.NoError(t, err)
+	require.Len(t, chapters, 2)
+	assert.Equal(t, "Elden Ring", chapters[1].Title)
+	assert.Equal(t, "ELDEN RING", chapters[1].Game.Name)
+	assert.Equal(t, 10*time.Minute, chapters[1].Offset())
+	assert.Equal(t, 50*time.Minute, chapters[1].Duration())
+
+	_, err = api.Chapters(context.Background(), "1")
+	assert.Error(t, err)
+}
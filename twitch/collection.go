@@ -0,0 +1,74 @@
+package twitch
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Collection is an ordered list of VODs, also known as a playlist.
+type Collection struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Owner       User      `json:"owner"`
+	VODs        []VOD     `json:"vods"`
+}
+
+const collectionQuery = `query Collection($id: ID!, $after: Cursor) {
+  collection(id: $id) {
+    id title description updatedAt
+    owner { id login displayName }
+    items(first: 100, after: $after) {
+      edges { cursor node { ... on Video { ` + vodFields + ` } } }
+      pageInfo { hasNextPage }
+    }
+  }
+}`
+
+// Collection retrieves the collection "id" along with its VODs, in order.
+func (c *Client) Collection(ctx context.Context, id string) (Collection, error) {
+	type payload struct {
+		Data struct {
+			Collection *struct {
+				Collection
+				Items struct {
+					Edges []struct {
+						Cursor string    `json:"cursor"`
+						Node   *gqlVideo `json:"node"`
+					} `json:"edges"`
+					PageInfo struct {
+						HasNextPage bool `json:"hasNextPage"`
+					} `json:"pageInfo"`
+				} `json:"items"`
+			} `json:"collection"`
+		} `json:"data"`
+	}
+	var collection Collection
+	var after interface{}
+	for {
+		var p payload
+		if err := c.gql(ctx, collectionQuery, map[string]interface{}{"id": id, "after": after}, &p); err != nil {
+			return Collection{}, err
+		}
+		if p.Data.Collection == nil {
+			return Collection{}, errors.Wrapf(ErrNotFound, "collection %s", id)
+		}
+		vods := collection.VODs
+		collection = p.Data.Collection.Collection
+		collection.VODs = vods
+		for _, edge := range p.Data.Collection.Items.Edges {
+			after = edge.Cursor
+			// Deleted VODs are null.
+			if edge.Node == nil || len(edge.Node.ID) == 0 {
+				continue
+			}
+			collection.VODs = append(collection.VODs, edge.Node.vod())
+		}
+		if !p.Data.Collection.Items.PageInfo.HasNextPage || len(p.Data.Collection.Items.Edges) == 0 {
+			return collection, nil
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package twitch_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jybp/twitch-downloader/twitch"
+)
+
+func TestCollection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables struct {
+				ID    string  `json:"id"`
+				After *string `json:"after"`
+			} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Variables.ID != "abc" {
+			w.Write([]byte(`{"data":{"collection":null}}`))
+			return
+		}
+		if req.Variables.After == nil {
+			w.Write([]byte(`{"data":{"collection":{"id":"abc","title":"Playlist","owner":{"login":"owner"},"items":{
+				"edges":[
+					{"cursor":"c1","node":{"id":"1","title":"First","lengthSeconds":60}},
+					{"cursor":"c2","node":null}
+				],
+				"pageInfo":{"hasNextPage":true}}}}}`))
+			return
+		}
+		assert.Equal(t, "c2", *req.Variables.After)
+		w.Write([]byte(`{"data":{"collection":{"id":"abc","title":"Playlist","owner":{"login":"owner"},"items":{
+			"edges":[{"cursor":"c3","node":{"id":"2","title":"Second","lengthSeconds":120}}],
+			"pageInfo":{"hasNextPage":false}}}}}`))
+	}))
+	defer srv.Close()
+	api := twitch.Custom(srv.Client(), "clientID", srv.URL, srv.URL)
+
+	collection, err := api.Collection(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", collection.ID)
+	assert.Equal(t, "Playlist", collection.Title)
+	assert.Equal(t, "owner", collection.Owner.Login)
+	require.Len(t, collection.VODs, 2)
+	assert.Equal(t, "1", collection.VODs[0].ID)
+	assert.Equal(t, "2", collection.VODs[1].ID)
+
+	_, err = api.Collection(context.Background(), "404")
+	assert.Error(t, err)
+}
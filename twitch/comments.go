@@ -0,0 +1,93 @@
+package twitch
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Comment is a chat message of a VOD.
+type Comment struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	// OffsetSeconds is the position of the message inside the VOD.
+	OffsetSeconds int    `json:"contentOffsetSeconds"`
+	Commenter     User   `json:"commenter"`
+	Message       string `json:"message"`
+	Color         string `json:"color,omitempty"`
+}
+
+const commentsQuery = `query Comments($id: ID!, $after: Cursor) {
+  video(id: $id) {
+    comments(after: $after) {
+      edges { cursor node {
+        id createdAt contentOffsetSeconds
+        commenter { id login displayName }
+        message { fragments { text } userColor }
+      } }
+      pageInfo { hasNextPage }
+    }
+  }
+}`
+
+// Comments retrieves the chat replay of the VOD "id" in chronological order
+// and calls fn for each message. Retrieval stops at the first error of fn.
+func (c *Client) Comments(ctx context.Context, id string, fn func(Comment) error) error {
+	type payload struct {
+		Data struct {
+			Video *struct {
+				Comments struct {
+					Edges []struct {
+						Cursor string `json:"cursor"`
+						Node   struct {
+							Comment
+							Commenter *User `json:"commenter"`
+							Message   struct {
+								Fragments []struct {
+									Text string `json:"text"`
+								} `json:"fragments"`
+								UserColor string `json:"userColor"`
+							} `json:"message"`
+						} `json:"node"`
+					} `json:"edges"`
+					PageInfo struct {
+						HasNextPage bool `json:"hasNextPage"`
+					} `json:"pageInfo"`
+				} `json:"comments"`
+			} `json:"video"`
+		} `json:"data"`
+	}
+	variables := map[string]interface{}{"id": id}
+	for {
+		var p payload
+		if err := c.gql(ctx, commentsQuery, variables, &p); err != nil {
+			return err
+		}
+		if p.Data.Video == nil {
+			return errors.Wrapf(ErrNotFound, "VOD %s", id)
+		}
+		comments := p.Data.Video.Comments
+		for _, edge := range comments.Edges {
+			variables["after"] = edge.Cursor
+			comment := edge.Node.Comment
+			// Deleted users are null.
+			if edge.Node.Commenter != nil {
+				comment.Commenter = *edge.Node.Commenter
+			}
+			var b strings.Builder
+			for _, f := range edge.Node.Message.Fragments {
+				b.WriteString(f.Text)
+			}
+			comment.Message = b.String()
+			comment.Color = edge.Node.Message.UserColor
+			if err := fn(comment); err != nil {
+				return err
+			}
+		}
+		if !comments.PageInfo.HasNextPage || len(comments.Edges) == 0 {
+			return nil
+		}
+	}
+}
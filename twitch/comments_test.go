@@ -0,0 +1,53 @@
+package twitch_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jybp/twitch-downloader/twitch"
+)
+
+func TestComments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]string `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if len(req.Variables["after"]) == 0 {
+			w.Write([]byte(`{"data":{"video":{"comments":{"edges":[
+				{"cursor":"c1","node":{"id":"a","contentOffsetSeconds":1,
+					"commenter":{"login":"user","displayName":"User"},
+					"message":{"fragments":[{"text":"hello "},{"text":"Kappa"}],"userColor":"#FF0000"}}}
+			],"pageInfo":{"hasNextPage":true}}}}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"video":{"comments":{"edges":[
+			{"cursor":"c2","node":{"id":"b","contentOffsetSeconds":5,"commenter":null,
+				"message":{"fragments":[{"text":"bye"}]}}}
+		],"pageInfo":{"hasNextPage":false}}}}}`))
+	}))
+	defer srv.Close()
+	api := twitch.Custom(srv.Client(), "clientID", srv.URL, srv.URL)
+
+	var comments []twitch.Comment
+	err := api.Comments(context.Background(), "12345", func(c twitch.Comment) error {
+		comments = append(comments, c)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, "a", comments[0].ID)
+	assert.Equal(t, 1, comments[0].OffsetSeconds)
+	assert.Equal(t, "User", comments[0].Commenter.DisplayName)
+	assert.Equal(t, "hello Kappa", comments[0].Message)
+	assert.Equal(t, "#FF0000", comments[0].Color)
+	assert.Equal(t, "b", comments[1].ID)
+	assert.Equal(t, "", comments[1].Commenter.Login)
+	assert.Equal(t, "bye", comments[1].Message)
+}
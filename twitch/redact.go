@@ -0,0 +1,104 @@
+package twitch
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// sensitiveHeaders are the HTTP headers that may hold credentials.
+var sensitiveHeaders = []string{"Client-Id", "Authorization", "Cookie", "Set-Cookie"}
+
+// sensitiveParams are the query parameters that may hold playback tokens.
+var sensitiveParams = []string{"nauth", "nauthsig", "sig", "token"}
+
+var (
+	headerRegexp = regexp.MustCompile(`(?im)^(Client-Id|Authorization|Cookie|Set-Cookie):[^\r\n]*`)
+	paramRegexp  = regexp.MustCompile(`([?&](?:nauth|nauthsig|sig|token)=)[^&\s"']*`)
+	jsonRegexp   = regexp.MustCompile(`("(?:signature|value|token)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// Redact removes credentials, playback tokens and cookies from s.
+// s can be any text such as an URL, an HTTP dump or an error message.
+func Redact(s string) string {
+	s = headerRegexp.ReplaceAllString(s, "$1: "+redacted)
+	s = paramRegexp.ReplaceAllString(s, "${1}"+redacted)
+	return jsonRegexp.ReplaceAllString(s, `$1"`+redacted+`"`)
+}
+
+// RedactURL returns rawURL with its sensitive query parameters redacted.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Redact(rawURL)
+	}
+	q := u.Query()
+	changed := false
+	for _, p := range sensitiveParams {
+		if _, ok := q[p]; ok {
+			q.Set(p, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// RedactHeader returns a copy of h with its sensitive headers redacted.
+func RedactHeader(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	c := http.Header{}
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	for _, k := range sensitiveHeaders {
+		for ck := range c {
+			if strings.EqualFold(ck, k) {
+				c[ck] = []string{redacted}
+			}
+		}
+	}
+	return c
+}
+
+// Trace is the record of an HTTP exchange with the twitch API.
+// Secrets are redacted from every field.
+type Trace struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"request_header,omitempty"`
+	RequestBody    string      `json:"request_body,omitempty"`
+	StatusCode     int         `json:"status_code,omitempty"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	ResponseBody   string      `json:"response_body,omitempty"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// Error is returned when a request to the twitch API fails.
+// Its message never contains secrets. Trace holds the details of the
+// exchange and is meant to be written only when explicitly requested.
+type Error struct {
+	StatusCode int
+	Trace      Trace
+	msg        string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// RedactError redacts the URL held by err when err is an *url.Error,
+// such as the ones returned by http.Client.Do.
+func RedactError(err error) error {
+	if ue, ok := err.(*url.Error); ok {
+		return &url.Error{Op: ue.Op, URL: RedactURL(ue.URL), Err: ue.Err}
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package twitch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jybp/twitch-downloader/twitch"
+)
+
+func TestRedact(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "https://usher.ttvnw.net/vod/1?nauth=abc&nauthsig=def&allow_source=true",
+			expected: "https://usher.ttvnw.net/vod/1?nauth=REDACTED&nauthsig=REDACTED&allow_source=true",
+		},
+		{
+			input:    "404: https://clips.example.com/a.mp4?sig=abc&token=%7B%22a%22%7D",
+			expected: "404: https://clips.example.com/a.mp4?sig=REDACTED&token=REDACTED",
+		},
+		{
+			input:    "POST /gql HTTP/1.1\r\nClient-Id: secret\r\nAuthorization: OAuth secret\r\nCookie: a=b\r\n",
+			expected: "POST /gql HTTP/1.1\r\nClient-Id: REDACTED\r\nAuthorization: REDACTED\r\nCookie: REDACTED\r\n",
+		},
+		{
+			input:    `{"value":"{\"channel\":\"x\"}","signature":"abc"}`,
+			expected: `{"value":"REDACTED","signature":"REDACTED"}`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.expected, twitch.Redact(tc.input))
+		})
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	actual := twitch.RedactURL("https://usher.ttvnw.net/vod/1?allow_source=true&nauth=%7B%7D&nauthsig=abc")
+	assert.Equal(t, "https://usher.ttvnw.net/vod/1?allow_source=true&nauth=REDACTED&nauthsig=REDACTED", actual)
+}
+
+func TestRedactHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Client-Id", "secret")
+	h.Set("Accept", "*/*")
+	actual := twitch.RedactHeader(h)
+	assert.Equal(t, "REDACTED", actual.Get("Client-Id"))
+	assert.Equal(t, "*/*", actual.Get("Accept"))
+	assert.Equal(t, "secret", h.Get("Client-Id"))
+}
+
+func TestErrorIsRedacted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gql" {
+			w.Write([]byte(`{"data":{"videoPlaybackAccessToken":{"value":"secret-token","signature":"secret-sig"}}}`))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(r.URL.String()))
+	}))
+	defer srv.Close()
+
+	api := twitch.Custom(srv.Client(), "secret-client-id", srv.URL+"/gql", srv.URL)
+	_, err := api.M3U8(context.Background(), "12345")
+	require.Error(t, err)
+
+	apiErr, ok := errors.Cause(err).(*twitch.Error)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, http.StatusForbidden, apiErr.Trace.StatusCode)
+	assert.Contains(t, apiErr.Trace.URL, "/vod/12345")
+
+	for _, s := range []string{err.Error(), apiErr.Trace.URL, apiErr.Trace.ResponseBody} {
+		assert.False(t, strings.Contains(s, "secret"), s)
+	}
+}
@@ -1,15 +1,17 @@
 package twitch
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
 	"net/url"
-	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -19,28 +21,166 @@ type VideoType int
 const (
 	TypeVOD VideoType = iota
 	TypeClip
+	TypeCollection
+	TypeChannel
 )
 
+// Video identifies a twitch video.
+type Video struct {
+	// ID is the VOD ID, the clip slug, the collection ID or the channel login
+	// depending on Type.
+	ID   string
+	Type VideoType
+	// Channel is the channel login when it is part of the URL.
+	Channel string
+	// Start is the offset of a share link, such as "?t=1h2m3s".
+	Start time.Duration
+}
+
+var (
+	vodIDRegexp   = regexp.MustCompile(`^v?([0-9]+)$`)
+	slugRegexp    = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	channelRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{1,25}$`)
+)
+
+// reservedPaths are first path elements of twitch.tv that are not channels.
+var reservedPaths = map[string]bool{
+	"directory": true, "downloads": true, "jobs": true, "p": true, "search": true,
+	"settings": true, "subscriptions": true, "turbo": true, "wallet": true,
+	"inventory": true, "drops": true, "friends": true, "messages": true,
+	"videos": true, "collections": true, "clip": true, "clips": true, "embed": true,
+	"following": true, "login": true, "signup": true, "logout": true, "prime": true,
+	"moderator": true, "popout": true, "broadcast": true, "store": true, "bits": true,
+}
+
 // ID extract the ID/slug and type from a VOD url.
+// See Parse for the supported formats.
 func ID(URL string) (string, VideoType, error) {
+	v, err := Parse(URL)
+	if err != nil {
+		return "", 0, err
+	}
+	return v.ID, v.Type, nil
+}
+
+// Parse identifies the video of a twitch URL.
+// Supported formats include www., m. and player.twitch.tv URLs of VODs,
+// clips, collections and channels, clips.twitch.tv URLs, and bare VOD IDs
+// such as "123" or "v123".
+func Parse(URL string) (Video, error) {
+	URL = strings.TrimSpace(URL)
+	if m := vodIDRegexp.FindStringSubmatch(URL); m != nil {
+		return Video{ID: m[1], Type: TypeVOD}, nil
+	}
 	u, err := url.Parse(URL)
 	if err != nil {
-		return "", 0, errors.WithStack(err)
+		return Video{}, errors.WithStack(err)
+	}
+	if len(u.Scheme) == 0 {
+		// Allow "twitch.tv/videos/123".
+		if u, err = url.Parse("https://" + URL); err != nil {
+			return Video{}, errors.WithStack(err)
+		}
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != "twitch.tv" && !strings.HasSuffix(host, ".twitch.tv") {
+		return Video{}, errors.Errorf("URL host for %s is not twitch.tv", URL)
+	}
+	v, err := parsePath(host, u.Path, u.Query())
+	if err != nil {
+		return Video{}, errors.Wrapf(err, "Cannot extract VOD ID or clip slug from URL %s", URL)
+	}
+	if t := u.Query().Get("t"); len(t) > 0 {
+		v.Start, err = parseOffset(t)
+		if err != nil {
+			return Video{}, err
+		}
+	}
+	return v, nil
+}
+
+func parsePath(host, p string, q url.Values) (Video, error) {
+	var elems []string
+	for _, e := range strings.Split(p, "/") {
+		if len(e) > 0 {
+			elems = append(elems, e)
+		}
+	}
+	slug := func(id string, vType VideoType, channel string) (Video, error) {
+		if !slugRegexp.MatchString(id) {
+			return Video{}, errors.Errorf("invalid ID %q", id)
+		}
+		return Video{ID: id, Type: vType, Channel: channel}, nil
+	}
+	vod := func(id, channel string) (Video, error) {
+		m := vodIDRegexp.FindStringSubmatch(id)
+		if m == nil {
+			return Video{}, errors.Errorf("invalid VOD ID %q", id)
+		}
+		return Video{ID: m[1], Type: TypeVOD, Channel: channel}, nil
+	}
+
+	// Embeds and players use query parameters.
+	if id := q.Get("video"); len(id) > 0 {
+		return vod(id, q.Get("channel"))
+	}
+	if id := q.Get("clip"); len(id) > 0 {
+		return slug(id, TypeClip, "")
+	}
+	if id := q.Get("collection"); len(id) > 0 && len(elems) == 0 {
+		return slug(id, TypeCollection, "")
+	}
+	if c := q.Get("channel"); len(c) > 0 && len(elems) == 0 {
+		return channel(c)
+	}
+
+	if strings.HasPrefix(host, "clips.") {
+		if len(elems) == 1 && elems[0] != "embed" {
+			return slug(elems[0], TypeClip, "")
+		}
+		return Video{}, errors.New("missing clip slug")
 	}
-	if !strings.Contains(u.Hostname(), "twitch.tv") {
-		return "", 0, errors.Errorf("URL host for %s is not twitch.tv", URL)
+
+	switch {
+	case len(elems) == 2 && elems[0] == "videos":
+		return vod(elems[1], "")
+	case len(elems) == 2 && (elems[0] == "clip" || elems[0] == "clips"):
+		return slug(elems[1], TypeClip, "")
+	case len(elems) == 2 && elems[0] == "collections":
+		return slug(elems[1], TypeCollection, "")
+	case len(elems) == 3 && (elems[1] == "video" || elems[1] == "v"):
+		return vod(elems[2], elems[0])
+	case len(elems) == 3 && elems[1] == "clip":
+		return slug(elems[2], TypeClip, elems[0])
+	case len(elems) == 1 && !reservedPaths[strings.ToLower(elems[0])]:
+		return channel(elems[0])
 	}
-	if strings.HasPrefix(u.Path, "/videos/") || strings.Contains(u.Path, "/video/") {
-		_, id := path.Split(u.Path)
-		return id, TypeVOD, nil
+	return Video{}, errors.New("unsupported path")
+}
+
+func channel(login string) (Video, error) {
+	if !channelRegexp.MatchString(login) {
+		return Video{}, errors.Errorf("invalid channel %q", login)
 	}
-	if strings.Contains(u.Path, "/clip/") || strings.Contains(u.Hostname(), "clips.twitch.tv") {
-		_, id := path.Split(u.Path)
-		return id, TypeClip, nil
+	login = strings.ToLower(login)
+	return Video{ID: login, Type: TypeChannel, Channel: login}, nil
+}
+
+// parseOffset parses share link offsets such as "1h2m3s", "90s" or "5025".
+func parseOffset(t string) (time.Duration, error) {
+	if n, err := strconv.Atoi(t); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	d, err := time.ParseDuration(t)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("invalid offset %q", t)
 	}
-	return "", 0, errors.New("Cannot extract VOD ID or clip slug from URL")
+	return d, nil
 }
 
+// ErrNotFound is returned when a video does not exist or is no longer available.
+var ErrNotFound = errors.New("not found")
+
 // Client manages communication with the twitch API.
 type Client struct {
 	client      *http.Client
@@ -84,55 +224,201 @@ func (c *Client) vodToken(ctx context.Context, id string) (token, sig string, _
 }
 
 func (c *Client) do(ctx context.Context, req *http.Request, v interface{}) error {
-	dump, err := httputil.DumpRequestOut(req, true)
+	b, err := c.send(req)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return c.fail(req, nil, b, err.Error())
 	}
-	resp, err := http.DefaultClient.Do(req)
+	return nil
+}
+
+// send performs req and returns the response body.
+// Errors are *Error whose message and Trace are free of secrets.
+func (c *Client) send(req *http.Request) ([]byte, error) {
+	resp, err := c.client.Do(req)
 	if err != nil {
-		return errors.Errorf("%v\n%s", err, string(dump))
+		return nil, c.fail(req, nil, nil, err.Error())
 	}
 	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, c.fail(req, resp, nil, err.Error())
+	}
 	if s := resp.StatusCode; s < 200 || s >= 300 {
-		return errors.Errorf("invalid status code %d\n%s", s, string(dump))
+		return nil, c.fail(req, resp, b, fmt.Sprintf("invalid status code %d", s))
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
-		return errors.Errorf("%v\n%s", err, string(dump))
+	return b, nil
+}
+
+// fail builds the *Error describing a failed exchange.
+func (c *Client) fail(req *http.Request, resp *http.Response, respBody []byte, msg string) error {
+	msg = Redact(msg)
+	e := &Error{
+		Trace: Trace{
+			Method:        req.Method,
+			URL:           RedactURL(req.URL.String()),
+			RequestHeader: RedactHeader(req.Header),
+			ResponseBody:  Redact(string(respBody)),
+			Error:         msg,
+		},
+		msg: fmt.Sprintf("%s %s: %s", req.Method, RedactURL(req.URL.String()), msg),
 	}
-	return nil
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, _ := ioutil.ReadAll(body)
+			e.Trace.RequestBody = Redact(string(b))
+		}
+	}
+	if resp != nil {
+		e.StatusCode = resp.StatusCode
+		e.Trace.StatusCode = resp.StatusCode
+		e.Trace.ResponseHeader = RedactHeader(resp.Header)
+	}
+	return errors.WithStack(e)
+}
+
+// BroadcastType is the kind of a VOD.
+type BroadcastType string
+
+// Broadcast types.
+const (
+	BroadcastArchive   BroadcastType = "ARCHIVE"
+	BroadcastHighlight BroadcastType = "HIGHLIGHT"
+	BroadcastUpload    BroadcastType = "UPLOAD"
+)
+
+// User is a twitch user such as the owner of a VOD.
+type User struct {
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"displayName"`
+}
+
+// Game is the category of a video.
+type Game struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// MutedSegment is a range of a VOD whose audio has been muted.
+// Offset and Duration are in seconds.
+type MutedSegment struct {
+	Offset   int `json:"offset"`
+	Duration int `json:"duration"`
 }
 
 // VOD contains infos on a twitch VOD.
 type VOD struct {
-	Title string `json:"title"`
-	Owner struct {
-		DisplayName string `json:"displayName"`
-	} `json:"owner"`
-	Game struct {
-		Name string `json:"name"`
-	} `json:"game"`
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Status is "RECORDING" while the stream of an archive is live.
+	Status          string         `json:"status"`
+	LengthSeconds   int            `json:"lengthSeconds"`
+	CreatedAt       time.Time      `json:"createdAt"`
+	PublishedAt     time.Time      `json:"publishedAt"`
+	ViewCount       int            `json:"viewCount"`
+	Language        string         `json:"language"`
+	BroadcastType   BroadcastType  `json:"broadcastType"`
+	ThumbnailURL    string         `json:"previewThumbnailURL"`
+	PreviewURL      string         `json:"animatedPreviewURL"`
+	SeekPreviewsURL string         `json:"seekPreviewsURL"`
+	Owner           User           `json:"owner"`
+	Game            Game           `json:"game"`
+	Tags            []string       `json:"tags"`
+	MutedSegments   []MutedSegment `json:"mutedSegments"`
 }
 
-// Name retrieves the name of the video from a URL.
-func (c *Client) VOD(ctx context.Context, id string) (VOD, error) {
-	gqlPayload := `{"operationName":"VideoMetadata","variables":{"channelLogin":"","videoID":"%s"},"extensions":{"persistedQuery":{"version":1,"sha256Hash":"226edb3e692509f727fd56821f5653c05740242c82b0388883e0c0e75dcbf687"}}}`
-	body := strings.NewReader(fmt.Sprintf(gqlPayload, id))
-	req, err := http.NewRequest(http.MethodPost, c.apiURL, body)
-	if err != nil {
-		return VOD{}, errors.WithStack(err)
+// Duration returns the length of the VOD.
+func (v VOD) Duration() time.Duration {
+	return time.Duration(v.LengthSeconds) * time.Second
+}
+
+// vodFields are the fields of a VOD to query, decoded by gqlVideo.
+const vodFields = `id title description status lengthSeconds createdAt publishedAt viewCount language broadcastType
+    previewThumbnailURL(width: 1920, height: 1080) animatedPreviewURL seekPreviewsURL
+    owner { id login displayName }
+    game { id name displayName }
+    contentTags { localizedName }
+    muteInfo { mutedSegmentConnection { nodes { offset duration } } }`
+
+const vodQuery = `query VOD($id: ID!) {
+  video(id: $id) { ` + vodFields + ` }
+}`
+
+// gqlVideo is the GQL representation of a VOD.
+type gqlVideo struct {
+	VOD
+	ContentTags []struct {
+		LocalizedName string `json:"localizedName"`
+	} `json:"contentTags"`
+	MuteInfo struct {
+		MutedSegmentConnection struct {
+			Nodes []MutedSegment `json:"nodes"`
+		} `json:"mutedSegmentConnection"`
+	} `json:"muteInfo"`
+}
+
+func (v gqlVideo) vod() VOD {
+	vod := v.VOD
+	for _, tag := range v.ContentTags {
+		vod.Tags = append(vod.Tags, tag.LocalizedName)
 	}
-	req = req.WithContext(ctx)
-	req.Header.Set("Client-Id", c.clientID)
+	vod.MutedSegments = v.MuteInfo.MutedSegmentConnection.Nodes
+	return vod
+}
+
+// VOD retrieves the metadata of the VOD "id" in a single request.
+func (c *Client) VOD(ctx context.Context, id string) (VOD, error) {
 	type payload struct {
 		Data struct {
-			Video VOD `json:"video"`
+			Video *gqlVideo `json:"video"`
 		} `json:"data"`
 	}
 	var p payload
-	if err := c.do(ctx, req, &p); err != nil {
+	if err := c.gql(ctx, vodQuery, map[string]interface{}{"id": id}, &p); err != nil {
 		return VOD{}, err
 	}
-	return p.Data.Video, nil
+	if p.Data.Video == nil {
+		return VOD{}, errors.Wrapf(ErrNotFound, "VOD %s", id)
+	}
+	return p.Data.Video.vod(), nil
+}
+
+// gql sends a GraphQL query to the twitch API and decodes the response into v.
+func (c *Client) gql(ctx context.Context, query string, variables map[string]interface{}, v interface{}) error {
+	body, err := json.Marshal(struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}{query, variables})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.apiURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Client-Id", c.clientID)
+	b, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	var gqlErrors struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(b, &gqlErrors); err == nil && len(gqlErrors.Errors) > 0 {
+		return c.fail(req, nil, b, gqlErrors.Errors[0].Message)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return c.fail(req, nil, b, err.Error())
+	}
+	return nil
 }
 
 type ClipVideo struct {
@@ -168,53 +454,106 @@ func (c *Client) ClipVideo(ctx context.Context, slug string) (ClipVideo, error)
 	return p.Data.ClipVideo, nil
 }
 
+// Clip contains infos on a twitch clip.
 type Clip struct {
-	Broadcaster struct {
-		DisplayName string `json:"displayName"`
-	} `json:"broadcaster"`
-	Title string `json:"title"`
-	Game  struct {
-		Name string `json:"name"`
-	} `json:"game"`
+	ID                 string    `json:"id"`
+	Slug               string    `json:"slug"`
+	Title              string    `json:"title"`
+	CreatedAt          time.Time `json:"createdAt"`
+	ViewCount          int       `json:"viewCount"`
+	DurationSeconds    float64   `json:"durationSeconds"`
+	Language           string    `json:"language"`
+	ThumbnailURL       string    `json:"thumbnailURL"`
+	Broadcaster        User      `json:"broadcaster"`
+	Curator            User      `json:"curator"`
+	Game               Game      `json:"game"`
+	VideoID            string    `json:"videoID"`
+	VideoOffsetSeconds int       `json:"videoOffsetSeconds"`
+}
+
+// Duration returns the length of the clip.
+func (c Clip) Duration() time.Duration {
+	return time.Duration(c.DurationSeconds * float64(time.Second))
+}
+
+// VideoOffset returns the position of the clip inside its source VOD.
+// It is only meaningful when VideoID is not empty.
+func (c Clip) VideoOffset() time.Duration {
+	return time.Duration(c.VideoOffsetSeconds) * time.Second
 }
 
+const clipQuery = `query Clip($slug: ID!) {
+  clip(slug: $slug) {
+    id slug title createdAt viewCount durationSeconds language thumbnailURL
+    broadcaster { id login displayName }
+    curator { id login displayName }
+    game { id name displayName }
+    video { id }
+    videoOffsetSeconds
+  }
+}`
+
+// Clip retrieves the metadata of the clip "slug" in a single request.
 func (c *Client) Clip(ctx context.Context, slug string) (Clip, error) {
-	gqlPayload := `{"operationName":"ComscoreStreamingQuery","variables":{"channel":"","clipSlug":"%s","isClip":true,"isLive":false,"isVodOrCollection":false,"vodID":""},"extensions":{"persistedQuery":{"version":1,"sha256Hash":"e1edae8122517d013405f237ffcc124515dc6ded82480a88daef69c83b53ac01"}}}`
-	body := strings.NewReader(fmt.Sprintf(gqlPayload, slug))
-	req, err := http.NewRequest(http.MethodPost, c.apiURL, body)
-	if err != nil {
-		return Clip{}, errors.WithStack(err)
+	type clip struct {
+		Clip
+		Video *struct {
+			ID string `json:"id"`
+		} `json:"video"`
 	}
-	req = req.WithContext(ctx)
-	req.Header.Set("Client-Id", c.clientID)
 	type payload struct {
 		Data struct {
-			Clip Clip `json:"clip"`
+			Clip *clip `json:"clip"`
 		} `json:"data"`
 	}
 	var p payload
-	if err := c.do(ctx, req, &p); err != nil {
+	if err := c.gql(ctx, clipQuery, map[string]interface{}{"slug": slug}, &p); err != nil {
 		return Clip{}, err
 	}
-	return p.Data.Clip, nil
+	if p.Data.Clip == nil {
+		return Clip{}, errors.Wrapf(ErrNotFound, "clip %s", slug)
+	}
+	result := p.Data.Clip.Clip
+	if v := p.Data.Clip.Video; v != nil {
+		result.VideoID = v.ID
+	}
+	return result, nil
 }
 
 // M3U8 retrieves the M3U8 file of a specific VOD.
 func (c *Client) M3U8(ctx context.Context, id string) ([]byte, error) {
+	b, _, err := c.M3U8Expires(ctx, id)
+	return b, err
+}
+
+// M3U8Expires returns the M3U8 file of the VOD "id" along with the expiry of
+// its playback token. The expiry is zero if unknown.
+func (c *Client) M3U8Expires(ctx context.Context, id string) ([]byte, time.Time, error) {
 	tok, sig, err := c.vodToken(ctx, id)
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
 	u := fmt.Sprintf("%s/vod/%s?nauth=%s&nauthsig=%s&allow_audio_only=true&allow_source=true",
-		c.usherAPIURL, id, tok, sig)
-	resp, err := c.client.Get(u)
+		c.usherAPIURL, id, url.QueryEscape(tok), url.QueryEscape(sig))
+	req, err := http.NewRequest(http.MethodGet, u, nil)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, time.Time{}, errors.New(Redact(err.Error()))
 	}
-	defer resp.Body.Close()
-	if s := resp.StatusCode; s < 200 || s >= 300 {
-		b, _ := ioutil.ReadAll(resp.Body)
-		return nil, errors.Errorf("%d\n%s\n%s", s, u, string(b))
+	b, err := c.send(req.WithContext(ctx))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return b, TokenExpiry(tok), nil
+}
+
+// TokenExpiry returns the expiry of a playback token, the JSON document
+// passed as nauth, or zero if unknown.
+func TokenExpiry(token string) time.Time {
+	var t struct {
+		Expires int64 `json:"expires"`
+	}
+	if err := json.Unmarshal([]byte(token), &t); err != nil || t.Expires <= 0 {
+		return time.Time{}
 	}
-	return ioutil.ReadAll(resp.Body)
+	return time.Unix(t.Expires, 0)
 }
@@ -1,9 +1,15 @@
 package twitch_test
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/jybp/twitch-downloader/twitch"
 )
@@ -62,3 +68,212 @@ func TestID(t *testing.T) {
 		})
 	}
 }
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		input       string
+		expected    twitch.Video
+		expectedErr bool
+	}{
+		{
+			input:    "12345",
+			expected: twitch.Video{ID: "12345", Type: twitch.TypeVOD},
+		},
+		{
+			input:    "v12345",
+			expected: twitch.Video{ID: "12345", Type: twitch.TypeVOD},
+		},
+		{
+			input:    "twitch.tv/videos/12345/",
+			expected: twitch.Video{ID: "12345", Type: twitch.TypeVOD},
+		},
+		{
+			input:    "https://m.twitch.tv/videos/12345?t=1h2m3s",
+			expected: twitch.Video{ID: "12345", Type: twitch.TypeVOD, Start: time.Hour + 2*time.Minute + 3*time.Second},
+		},
+		{
+			input:    "https://www.twitch.tv/videos/12345?t=5025",
+			expected: twitch.Video{ID: "12345", Type: twitch.TypeVOD, Start: 5025 * time.Second},
+		},
+		{
+			input:    "https://www.twitch.tv/videos/12345?collection=abc",
+			expected: twitch.Video{ID: "12345", Type: twitch.TypeVOD},
+		},
+		{
+			input:    "https://player.twitch.tv/?video=v12345&parent=example.com",
+			expected: twitch.Video{ID: "12345", Type: twitch.TypeVOD},
+		},
+		{
+			input:    "https://www.twitch.tv/test/v/12345",
+			expected: twitch.Video{ID: "12345", Type: twitch.TypeVOD, Channel: "test"},
+		},
+		{
+			input:    "https://www.twitch.tv/test/clip/Slug-123_a?filter=clips&range=7d&sort=time",
+			expected: twitch.Video{ID: "Slug-123_a", Type: twitch.TypeClip, Channel: "test"},
+		},
+		{
+			input:    "https://m.twitch.tv/clip/Slug123",
+			expected: twitch.Video{ID: "Slug123", Type: twitch.TypeClip},
+		},
+		{
+			input:    "https://clips.twitch.tv/embed?clip=Slug123&parent=example.com",
+			expected: twitch.Video{ID: "Slug123", Type: twitch.TypeClip},
+		},
+		{
+			input:    "https://clips.twitch.tv/Slug123/",
+			expected: twitch.Video{ID: "Slug123", Type: twitch.TypeClip},
+		},
+		{
+			input:    "https://www.twitch.tv/collections/AbC123xyz",
+			expected: twitch.Video{ID: "AbC123xyz", Type: twitch.TypeCollection},
+		},
+		{
+			input:    "https://player.twitch.tv/?collection=AbC123xyz",
+			expected: twitch.Video{ID: "AbC123xyz", Type: twitch.TypeCollection},
+		},
+		{
+			input:    "https://www.twitch.tv/Test_Channel",
+			expected: twitch.Video{ID: "test_channel", Type: twitch.TypeChannel, Channel: "test_channel"},
+		},
+		{
+			input:    "https://player.twitch.tv/?channel=test",
+			expected: twitch.Video{ID: "test", Type: twitch.TypeChannel, Channel: "test"},
+		},
+		{
+			input:       "https://www.twitch.tv/videos/abc",
+			expectedErr: true,
+		},
+		{
+			input:       "https://www.twitch.tv/videos/12345?t=abc",
+			expectedErr: true,
+		},
+		{
+			input:       "https://www.twitch.tv/directory",
+			expectedErr: true,
+		},
+		{
+			input:       "https://www.twitch.tv/videos",
+			expectedErr: true,
+		},
+		{
+			input:       "https://www.twitch.tv/collections/",
+			expectedErr: true,
+		},
+		{
+			input:       "https://www.twitch.tv/clips",
+			expectedErr: true,
+		},
+		{
+			input:       "twitch.tv/following",
+			expectedErr: true,
+		},
+		{
+			input:       "https://clips.twitch.tv/embed",
+			expectedErr: true,
+		},
+		{
+			input:       "https://nottwitch.tv/videos/12345",
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			v, err := twitch.Parse(tc.input)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, v)
+		})
+	}
+}
+
+func TestVOD(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]string `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Variables["id"] != "12345" {
+			w.Write([]byte(`{"data":{"video":null}}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"video":{
+			"id":"12345","title":"Title","description":"Desc","lengthSeconds":3600,
+			"createdAt":"2021-03-04T05:06:07Z","publishedAt":"2021-03-04T05:06:08Z",
+			"viewCount":42,"language":"en","broadcastType":"ARCHIVE",
+			"previewThumbnailURL":"https://example.com/thumb.jpg",
+			"animatedPreviewURL":"https://example.com/preview.mp4",
+			"seekPreviewsURL":"https://example.com/storyboard.json",
+			"owner":{"id":"1","login":"owner","displayName":"Owner"},
+			"game":{"id":"2","name":"Game","displayName":"Game"},
+			"contentTags":[{"localizedName":"English"},{"localizedName":"Speedrun"}],
+			"muteInfo":{"mutedSegmentConnection":{"nodes":[{"offset":360,"duration":180}]}}
+		}}}`))
+	}))
+	defer srv.Close()
+	api := twitch.Custom(srv.Client(), "clientID", srv.URL, srv.URL)
+
+	vod, err := api.VOD(context.Background(), "12345")
+	require.NoError(t, err)
+	assert.Equal(t, "12345", vod.ID)
+	assert.Equal(t, "Title", vod.Title)
+	assert.Equal(t, "Desc", vod.Description)
+	assert.Equal(t, time.Hour, vod.Duration())
+	assert.Equal(t, time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), vod.CreatedAt)
+	assert.Equal(t, time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC), vod.PublishedAt)
+	assert.Equal(t, 42, vod.ViewCount)
+	assert.Equal(t, "en", vod.Language)
+	assert.Equal(t, twitch.BroadcastArchive, vod.BroadcastType)
+	assert.Equal(t, "https://example.com/thumb.jpg", vod.ThumbnailURL)
+	assert.Equal(t, "https://example.com/preview.mp4", vod.PreviewURL)
+	assert.Equal(t, "https://example.com/storyboard.json", vod.SeekPreviewsURL)
+	assert.Equal(t, "1", vod.Owner.ID)
+	assert.Equal(t, "owner", vod.Owner.Login)
+	assert.Equal(t, "Owner", vod.Owner.DisplayName)
+	assert.Equal(t, "Game", vod.Game.Name)
+	assert.Equal(t, []string{"English", "Speedrun"}, vod.Tags)
+	assert.Equal(t, []twitch.MutedSegment{{Offset: 360, Duration: 180}}, vod.MutedSegments)
+
+	_, err = api.VOD(context.Background(), "404")
+	assert.Error(t, err)
+}
+
+func TestClip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"clip":{
+			"id":"99","slug":"Slug123","title":"Title","createdAt":"2021-03-04T05:06:07Z",
+			"viewCount":7,"durationSeconds":30,"language":"fr",
+			"thumbnailURL":"https://example.com/thumb.jpg",
+			"broadcaster":{"id":"1","login":"owner","displayName":"Owner"},
+			"curator":{"id":"3","login":"curator","displayName":"Curator"},
+			"game":{"id":"2","name":"Game","displayName":"Game"},
+			"video":{"id":"12345"},"videoOffsetSeconds":754
+		}}}`))
+	}))
+	defer srv.Close()
+	api := twitch.Custom(srv.Client(), "clientID", srv.URL, srv.URL)
+
+	clip, err := api.Clip(context.Background(), "Slug123")
+	require.NoError(t, err)
+	assert.Equal(t, "99", clip.ID)
+	assert.Equal(t, "Slug123", clip.Slug)
+	assert.Equal(t, "Title", clip.Title)
+	assert.Equal(t, time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), clip.CreatedAt)
+	assert.Equal(t, 7, clip.ViewCount)
+	assert.Equal(t, 30*time.Second, clip.Duration())
+	assert.Equal(t, "fr", clip.Language)
+	assert.Equal(t, "https://example.com/thumb.jpg", clip.ThumbnailURL)
+	assert.Equal(t, "Owner", clip.Broadcaster.DisplayName)
+	assert.Equal(t, "curator", clip.Curator.Login)
+	assert.Equal(t, "Game", clip.Game.Name)
+	assert.Equal(t, "12345", clip.VideoID)
+	assert.Equal(t, 12*time.Minute+34*time.Second, clip.VideoOffset())
+}
+
+func TestTokenExpiry(t *testing.T) {
+	assert.Equal(t, time.Unix(1700000000, 0), twitch.TokenExpiry(`{"authorization":{"forbidden":false},"expires":1700000000,"vod_id":12345}`))
+	assert.True(t, twitch.TokenExpiry(`{"vod_id":12345}`).IsZero())
+	assert.True(t, twitch.TokenExpiry("token").IsZero())
+}
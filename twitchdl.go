@@ -3,9 +3,11 @@ package twitchdl
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/pkg/errors"
@@ -14,33 +16,97 @@ import (
 	"github.com/jybp/twitch-downloader/twitch"
 )
 
-// Name return the name of the video: Channel Name - Video name.
-func Name(ctx context.Context, client *http.Client, clientID, vURL string) (string, error) {
+// Metadata holds the metadata of a VOD, a clip or a collection.
+// Only the field matching Type is set.
+type Metadata struct {
+	// Type is twitch.TypeVOD for HLS playlists.
+	Type twitch.VideoType `json:"type"`
+	// Source is the HLS playlist of videos that are not on twitch.
+	Source     string             `json:"source,omitempty"`
+	VOD        *twitch.VOD        `json:"vod,omitempty"`
+	Clip       *twitch.Clip       `json:"clip,omitempty"`
+	Collection *twitch.Collection `json:"collection,omitempty"`
+}
+
+// FetchMetadata retrieves the metadata of the video "vURL".
+func FetchMetadata(ctx context.Context, client *http.Client, clientID, vURL string) (Metadata, error) {
+	if IsPlaylist(vURL) {
+		return Metadata{Type: twitch.TypeVOD, Source: vURL}, nil
+	}
 	api := twitch.New(client, clientID)
 	id, vType, err := twitch.ID(vURL)
 	if err != nil {
-		return "", err
+		return Metadata{}, err
 	}
+	m := Metadata{Type: vType}
 	switch vType {
 	case twitch.TypeVOD:
 		vod, err := api.VOD(ctx, id)
 		if err != nil {
-			return "", err
+			return Metadata{}, err
 		}
-		return fmt.Sprintf("%s - %s", vod.Owner.DisplayName, vod.Title), nil
+		m.VOD = &vod
 	case twitch.TypeClip:
 		clip, err := api.Clip(ctx, id)
 		if err != nil {
-			return "", err
+			return Metadata{}, err
+		}
+		m.Clip = &clip
+	case twitch.TypeCollection:
+		collection, err := api.Collection(ctx, id)
+		if err != nil {
+			return Metadata{}, err
 		}
-		return fmt.Sprintf("%s - %s", clip.Broadcaster.DisplayName, clip.Title), nil
+		m.Collection = &collection
 	default:
-		return "", errors.Errorf("unsupported video type %d", vType)
+		return Metadata{}, errors.Errorf("unsupported video type %d", vType)
 	}
+	return m, nil
+}
+
+// Name return the name of the video: Channel Name - Video name.
+func (m Metadata) Name() string {
+	f := m.Fields()
+	return fmt.Sprintf("%s - %s", f.Channel, f.Title)
+}
+
+// Name return the name of the video: Channel Name - Video name.
+func Name(ctx context.Context, client *http.Client, clientID, vURL string) (string, error) {
+	m, err := FetchMetadata(ctx, client, clientID, vURL)
+	if err != nil {
+		return "", err
+	}
+	return m.Name(), nil
 }
 
 // Qualities return the qualities available.
 func Qualities(ctx context.Context, client *http.Client, clientID, vURL string) ([]string, error) {
+	details, err := QualityDetails(ctx, client, clientID, vURL)
+	if err != nil {
+		return nil, err
+	}
+	var qualities []string
+	for _, quality := range details {
+		qualities = append(qualities, quality.Name)
+	}
+	return qualities, nil
+}
+
+// Quality describes a quality available for a video.
+type Quality struct {
+	Name      string   `json:"name"`
+	Width     int      `json:"width,omitempty"`
+	Height    int      `json:"height,omitempty"`
+	FrameRate float64  `json:"frame_rate,omitempty"`
+	Bandwidth int      `json:"bandwidth,omitempty"`
+	Codecs    []string `json:"codecs,omitempty"`
+}
+
+// QualityDetails return the qualities available along with their properties.
+func QualityDetails(ctx context.Context, client *http.Client, clientID, vURL string) ([]Quality, error) {
+	if IsPlaylist(vURL) {
+		return hlsQualities(ctx, client, vURL)
+	}
 	api := twitch.New(client, clientID)
 	id, vType, err := twitch.ID(vURL)
 	if err != nil {
@@ -56,10 +122,17 @@ func Qualities(ctx context.Context, client *http.Client, clientID, vURL string)
 		if err != nil {
 			return nil, err
 		}
-		var qualities []string
+		var qualities []Quality
 		for _, variant := range master.Variants {
 			for _, alt := range variant.Alternatives {
-				qualities = append(qualities, alt.Name)
+				qualities = append(qualities, Quality{
+					Name:      alt.Name,
+					Width:     variant.Resolution.Width,
+					Height:    variant.Resolution.Height,
+					FrameRate: variant.FrameRate,
+					Bandwidth: variant.Bandwidth,
+					Codecs:    variant.Codecs,
+				})
 			}
 		}
 		return qualities, nil
@@ -68,29 +141,288 @@ func Qualities(ctx context.Context, client *http.Client, clientID, vURL string)
 		if err != nil {
 			return nil, err
 		}
-		var qualities []string
+		var qualities []Quality
 		for _, quality := range clip.Qualities {
-			qualities = append(qualities, fmt.Sprintf(clipQualityFramerateFormat, quality.Quality, quality.FrameRate))
+			height, _ := strconv.Atoi(quality.Quality)
+			qualities = append(qualities, Quality{
+				Name:      fmt.Sprintf(clipQualityFramerateFormat, quality.Quality, quality.FrameRate),
+				Height:    height,
+				FrameRate: quality.FrameRate,
+			})
 		}
 		return qualities, nil
+	case twitch.TypeCollection:
+		// The qualities of the first VOD are used for the whole collection.
+		collection, err := api.Collection(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if len(collection.VODs) == 0 {
+			return nil, errors.Errorf("collection %s is empty", id)
+		}
+		return QualityDetails(ctx, client, clientID, collection.VODs[0].ID)
 	default:
 		return nil, errors.Errorf("unsupported video type %d", vType)
 	}
 }
 
+// QualityBest selects the highest quality available.
+const QualityBest = "best"
+
+// Options configures a download.
+type Options struct {
+	// Quality is the name of the quality to download as returned by Qualities
+	// or QualityBest.
+	Quality string
+	// Start and End select a subset of a VOD. Zero values mean the start and
+	// the end of the VOD. Negative values are relative to the end of the VOD.
+	Start, End time.Duration
+	// Duration, when positive, sets End to Start plus Duration.
+	Duration time.Duration
+	// Ranges, when not empty, downloads the ranges of a VOD one after the
+	// other instead of Start and End. Segments shared by several ranges are
+	// included once. See DownloadRanges to download each range separately.
+	Ranges []Range
+	// Chapter, when not empty, downloads the chapters of a VOD whose title or
+	// game is Chapter instead of Start and End. See VODChapters.
+	Chapter string
+	// Unmuted, when true, downloads the original content of muted segments
+	// when it is still available. Muted segments are downloaded otherwise.
+	Unmuted bool
+	// Limiter, when not nil, caps the bandwidth of the download along with
+	// the other downloads sharing it.
+	Limiter *Limiter
+	// Hosts are alternate CDN hosts serving the segments of VODs with the
+	// same paths such as "vod-secure.twitch.tv". Segments are downloaded from
+	// the hosts with the best throughput in turn, failing over to the other
+	// hosts. A failing host is avoided for a while and then tried again.
+	Hosts []string
+	// GapFill is the strategy applied to the segments of a VOD whose
+	// download still fails after Retries. Filled gaps are listed by
+	// Info.Gaps.
+	GapFill GapFill
+	// ClipPadding, when positive, downloads the range of the source VOD of a
+	// clip extended by ClipPadding before and after the clip instead of the
+	// clip itself. Start and End are ignored.
+	ClipPadding time.Duration
+	// Retries is the number of times the download of a segment is retried
+	// before failing.
+	Retries int
+	// RetryDelay is the delay before the first retry. It doubles at each
+	// attempt. Zero defaults to one second.
+	RetryDelay time.Duration
+	// SplitDuration and SplitSize, when positive, limit the duration and the
+	// size in bytes of the parts returned by DownloadParts.
+	SplitDuration time.Duration
+	SplitSize     int64
+	// Resume skips the first Resume bytes of the download, typically the size
+	// of a partial download made with the same options. Segments entirely
+	// skipped are not downloaded when their size is known.
+	Resume int64
+	// RangeResumes skips the first RangeResumes[i] bytes of the stream of
+	// Ranges[i] returned by DownloadRanges, see Resume.
+	RangeResumes []int64
+	// Events, when not nil, is called to report the progress of the download.
+	Events func(Event)
+}
+
+// EventType is the type of an Event.
+type EventType string
+
+// Event types.
+const (
+	// EventSegment is reported when a segment has been downloaded.
+	EventSegment EventType = "segment"
+	// EventRetry is reported when the download of a segment is retried.
+	EventRetry EventType = "retry"
+	// EventUnmuted is reported when the original content of a muted segment
+	// is downloaded instead of the muted one.
+	EventUnmuted EventType = "unmuted"
+	// EventGap is reported when a segment is downloaded from another variant
+	// or left out according to Options.GapFill.
+	EventGap EventType = "gap"
+)
+
+// Event reports the progress of a download.
+type Event struct {
+	Type EventType
+	// Segment is the index of the segment, starting at 0, among the Segments
+	// segments of the download.
+	Segment  int
+	Segments int
+	// Bytes is the size of the segment for EventSegment.
+	Bytes int64
+	// Attempt and Err describe the failed attempt for EventRetry. Err is
+	// also the error of the segment for EventGap.
+	Attempt int
+	Err     error
+	// Quality is the quality the segment was downloaded from for EventGap,
+	// empty when the segment was left out.
+	Quality string
+}
+
+// Stream is the content of a video.
+// The download is actually perfomed when Stream is being read.
+type Stream struct {
+	io.ReadCloser
+	info Info
+	// infoFn, when not nil, describes streams whose content is known once
+	// read such as parts.
+	infoFn func() Info
+	// gaps, when not nil, records the gaps filled so far.
+	gaps *gaps
+	// hosts, when not nil, is the pool of CDN hosts of the segments.
+	hosts *hostPool
+	// muted, when not nil, returns the muted ranges left once the segments
+	// whose original content was downloaded are left out.
+	muted func() []Range
+}
+
+// Info describes the content of the stream.
+func (s *Stream) Info() Info {
+	if s.infoFn != nil {
+		return s.infoFn()
+	}
+	info := s.info
+	if s.gaps != nil {
+		info.Gaps = s.gaps.all()
+	}
+	if s.hosts != nil {
+		info.Hosts = s.hosts.all()
+	}
+	if s.muted != nil {
+		info.Muted = s.muted()
+	}
+	return info
+}
+
+// Info describes what a Stream is made of.
+type Info struct {
+	// Quality is the name of the quality being downloaded.
+	Quality string
+	// Variant is the variant of the master playlist being downloaded.
+	// It is nil for clips.
+	Variant *m3u8.Variant
+	// Segments are the media segments being downloaded. It is nil for clips.
+	Segments []m3u8.MediaSegment
+	// Start and End are the range of the VOD covered by Segments.
+	Start, End time.Duration
+	// Ranges are the ranges of the VOD downloaded one after the other when
+	// Options.Ranges or Options.Chapter is set.
+	Ranges []Range
+	// Muted are the ranges of the VOD covered by muted segments. With
+	// Options.Unmuted, the segments whose original content was downloaded so
+	// far are left out and reported by EventUnmuted.
+	Muted []Range
+	// Gaps are the segments filled according to Options.GapFill so far.
+	Gaps []Gap
+	// Hosts are the statistics of the CDN hosts when Options.Hosts is set.
+	Hosts []HostStats
+}
+
+// MarshalJSON summarizes the segments and uses seconds for durations.
+func (i Info) MarshalJSON() ([]byte, error) {
+	type gap struct {
+		Segment int     `json:"segment"`
+		Start   float64 `json:"start"`
+		End     float64 `json:"end"`
+		Quality string  `json:"quality,omitempty"`
+	}
+	type host struct {
+		Host       string  `json:"host"`
+		Requests   int     `json:"requests"`
+		Errors     int     `json:"errors"`
+		Bytes      int64   `json:"bytes"`
+		Throughput float64 `json:"throughput"`
+	}
+	type info struct {
+		Quality      string        `json:"quality"`
+		Variant      *m3u8.Variant `json:"variant,omitempty"`
+		FirstSegment *int          `json:"first_segment,omitempty"`
+		LastSegment  *int          `json:"last_segment,omitempty"`
+		SegmentCount int           `json:"segment_count,omitempty"`
+		Start        float64       `json:"start"`
+		End          float64       `json:"end"`
+		Ranges       [][2]float64  `json:"ranges,omitempty"`
+		Muted        [][2]float64  `json:"muted,omitempty"`
+		Gaps         []gap         `json:"gaps,omitempty"`
+		Hosts        []host        `json:"hosts,omitempty"`
+	}
+	v := info{
+		Quality:      i.Quality,
+		Variant:      i.Variant,
+		SegmentCount: len(i.Segments),
+		Start:        i.Start.Seconds(),
+		End:          i.End.Seconds(),
+	}
+	for _, r := range i.Ranges {
+		v.Ranges = append(v.Ranges, [2]float64{r.Start.Seconds(), r.End.Seconds()})
+	}
+	for _, r := range i.Muted {
+		v.Muted = append(v.Muted, [2]float64{r.Start.Seconds(), r.End.Seconds()})
+	}
+	for _, g := range i.Gaps {
+		v.Gaps = append(v.Gaps, gap{Segment: g.Segment, Start: g.Start.Seconds(), End: g.End.Seconds(), Quality: g.Quality})
+	}
+	for _, h := range i.Hosts {
+		v.Hosts = append(v.Hosts, host{Host: h.Host, Requests: h.Requests, Errors: h.Errors, Bytes: h.Bytes, Throughput: h.Throughput()})
+	}
+	if n := len(i.Segments); n > 0 {
+		v.FirstSegment = &i.Segments[0].Number
+		v.LastSegment = &i.Segments[n-1].Number
+	}
+	return json.Marshal(v)
+}
+
 // Download sets up the download of the VOD "vodId" with quality "quality"
 // using the provided http.Client.
 // The download is actually perfomed when the returned io.Reader is being read.
 func Download(ctx context.Context, client *http.Client, clientID, vURL, quality string, start, end time.Duration) (io.ReadCloser, error) {
+	stream, err := DownloadWithOptions(ctx, client, clientID, vURL, Options{Quality: quality, Start: start, End: end})
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// DownloadWithOptions is like Download but is configured by opts.
+func DownloadWithOptions(ctx context.Context, client *http.Client, clientID, vURL string, opts Options) (*Stream, error) {
+	if IsPlaylist(vURL) {
+		return downloadHLS(ctx, client, vURL, opts)
+	}
 	id, vType, err := twitch.ID(vURL)
 	if err != nil {
 		return nil, err
 	}
 	switch vType {
 	case twitch.TypeVOD:
-		return downloadVOD(ctx, client, clientID, id, quality, start, end)
+		return downloadVOD(ctx, client, clientID, id, opts)
 	case twitch.TypeClip:
-		return downloadClip(ctx, client, clientID, id, quality)
+		if opts.ClipPadding > 0 {
+			vodURL, start, end, err := ClipContext(ctx, client, clientID, vURL, opts.ClipPadding)
+			if err != nil {
+				return nil, err
+			}
+			vodID, _, err := twitch.ID(vodURL)
+			if err != nil {
+				return nil, err
+			}
+			opts.Start, opts.End, opts.Duration, opts.Ranges, opts.Chapter = start, end, 0, nil, ""
+			return downloadVOD(ctx, client, clientID, vodID, opts)
+		}
+		stream, err := downloadClip(ctx, client, clientID, id, opts.Quality)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Limiter != nil {
+			stream.ReadCloser = &limitReader{ReadCloser: stream.ReadCloser, l: opts.Limiter, ctx: ctx}
+		}
+		if opts.Resume <= 0 {
+			return stream, nil
+		}
+		body := stream.ReadCloser
+		stream.ReadCloser = &merger{ctx: ctx, downloads: []downloadFunc{func() (io.ReadCloser, error) { return body, nil }}, skip: opts.Resume}
+		return stream, nil
 	default:
 		return nil, errors.Errorf("unsupported video type %d", vType)
 	}
@@ -0,0 +1,132 @@
+package twitchdl
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// keyCache fetches the keys of encrypted segments once per URI.
+type keyCache struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+func newKeyCache() *keyCache {
+	return &keyCache{keys: map[string][]byte{}}
+}
+
+// get returns the key at uri.
+func (c *keyCache) get(ctx context.Context, client *http.Client, uri string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key, ok := c.keys[uri]; ok {
+		return key, nil
+	}
+	key, err := get(ctx, client, uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "key")
+	}
+	if len(key) != aes.BlockSize {
+		return nil, errors.Errorf("invalid key of %d bytes: %s", len(key), twitch.RedactURL(uri))
+	}
+	c.keys[uri] = key
+	return key, nil
+}
+
+// decrypt wraps download and size to decrypt segment. They are returned
+// as is when segment is not encrypted.
+func (c *keyCache) decrypt(ctx context.Context, client *http.Client, segment m3u8.MediaSegment, download downloadFunc, size sizeFunc) (downloadFunc, sizeFunc, error) {
+	key := segment.Key
+	if key == nil {
+		return download, size, nil
+	}
+	if key.Method != "AES-128" {
+		return nil, nil, errors.Errorf("unsupported encryption method %s", key.Method)
+	}
+	decrypted := func() (io.ReadCloser, error) {
+		k, err := c.get(ctx, client, key.URI)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		body, err := download()
+		if err != nil {
+			return nil, err
+		}
+		return &cbcReader{body: body, mode: cipher.NewCBCDecrypter(block, key.IV)}, nil
+	}
+	// The padding removed from the last block is only known once decrypted.
+	unknown := func() (int64, error) {
+		return 0, errors.New("unknown size of encrypted segment")
+	}
+	return decrypted, unknown, nil
+}
+
+// cbcReader decrypts the AES-CBC encrypted body and removes its PKCS#7
+// padding.
+type cbcReader struct {
+	body io.ReadCloser
+	mode cipher.BlockMode
+	buf  []byte
+	// in holds the bytes of an incomplete block.
+	in []byte
+	// out holds the decrypted bytes not read yet.
+	out []byte
+	// last is the last decrypted block, held back until the end of body
+	// to remove the padding.
+	last []byte
+	err  error
+}
+
+func (r *cbcReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.buf == nil {
+			r.buf = make([]byte, 32*1024)
+		}
+		n, err := r.body.Read(r.buf)
+		r.in = append(r.in, r.buf[:n]...)
+		if n := len(r.in) / aes.BlockSize * aes.BlockSize; n > 0 {
+			plain := make([]byte, n)
+			r.mode.CryptBlocks(plain, r.in[:n])
+			r.in = append(r.in[:0], r.in[n:]...)
+			plain = append(r.last, plain...)
+			r.out, r.last = plain[:len(plain)-aes.BlockSize], plain[len(plain)-aes.BlockSize:]
+		}
+		switch {
+		case err == io.EOF:
+			r.err = io.EOF
+			if len(r.in) > 0 || len(r.last) == 0 {
+				return 0, errors.New("truncated encrypted segment")
+			}
+			pad := int(r.last[aes.BlockSize-1])
+			if pad == 0 || pad > aes.BlockSize {
+				return 0, errors.New("invalid padding of encrypted segment")
+			}
+			r.out = append(r.out, r.last[:aes.BlockSize-pad]...)
+			r.last = nil
+		case err != nil:
+			r.err = err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *cbcReader) Close() error {
+	return r.body.Close()
+}
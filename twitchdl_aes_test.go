@@ -0,0 +1,91 @@
+package twitchdl
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encrypt encrypts plain with AES-128-CBC and PKCS#7 padding.
+func encrypt(t *testing.T, key, iv, plain []byte) []byte {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	b := append(append([]byte{}, plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(b, b)
+	return b
+}
+
+func TestCBCReader(t *testing.T) {
+	key, iv := []byte("0123456789abcdef"), []byte("fedcba9876543210")
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	for _, n := range []int{0, 1, 15, 16, 17, 100000} {
+		plain := bytes.Repeat([]byte("x"), n)
+		r := &cbcReader{
+			body: ioutil.NopCloser(iotest.OneByteReader(bytes.NewReader(encrypt(t, key, iv, plain)))),
+			mode: cipher.NewCBCDecrypter(block, iv),
+		}
+		b, err := ioutil.ReadAll(r)
+		require.NoError(t, err, n)
+		assert.Equal(t, plain, b, n)
+	}
+
+	r := &cbcReader{
+		body: ioutil.NopCloser(bytes.NewReader(encrypt(t, key, iv, []byte("abc"))[:10])),
+		mode: cipher.NewCBCDecrypter(block, iv),
+	}
+	_, err = ioutil.ReadAll(r)
+	assert.Error(t, err)
+}
+
+func TestDownloadEncrypted(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	explicit := []byte("fedcba9876543210")
+	var keys int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/index.m3u8":
+			fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:5\n"+
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"key\"\n"+
+				"#EXTINF:10.000,\n5.ts\n#EXTINF:10.000,\n6.ts\n"+
+				"#EXT-X-KEY:METHOD=AES-128,URI=\"key\",IV=0x%x\n"+
+				"#EXTINF:10.000,\n7.ts\n#EXT-X-ENDLIST\n", explicit)
+		case r.URL.Path == "/key":
+			keys++
+			w.Write(key)
+		case strings.HasSuffix(r.URL.Path, ".ts"):
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.Trim(r.URL.Path, "/"), ".ts"))
+			require.NoError(t, err)
+			iv := explicit
+			if n < 7 {
+				iv = make([]byte, 16)
+				binary.BigEndian.PutUint64(iv[8:], uint64(n))
+			}
+			w.Write(encrypt(t, key, iv, []byte(fmt.Sprintf("segment-%d;", n))))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	stream, err := DownloadWithOptions(context.Background(), srv.Client(), "", srv.URL+"/index.m3u8", Options{Quality: QualityBest, Resume: 10})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "segment-6;segment-7;", string(b))
+	assert.Equal(t, 1, keys)
+}
@@ -0,0 +1,131 @@
+package twitchdl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// Chapter is a titled range of a download.
+type Chapter struct {
+	Title string
+	// Game is the name of the game played during the chapter, if known.
+	Game       string
+	Start, End time.Duration
+}
+
+var ffmetadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+// WriteFFMetadata writes title and chapters using the ffmpeg metadata format.
+// The result can be muxed with "ffmpeg -i video.ts -i chapters.txt -map_metadata 1".
+//
+// https://ffmpeg.org/ffmpeg-formats.html#Metadata-1
+func WriteFFMetadata(w io.Writer, title string, chapters []Chapter) error {
+	b := &strings.Builder{}
+	b.WriteString(";FFMETADATA1\n")
+	if len(title) > 0 {
+		fmt.Fprintf(b, "title=%s\n", ffmetadataEscaper.Replace(title))
+	}
+	for _, c := range chapters {
+		fmt.Fprintf(b, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(c.Start/time.Millisecond), int64(c.End/time.Millisecond), ffmetadataEscaper.Replace(c.Title))
+	}
+	_, err := io.WriteString(w, b.String())
+	return errors.WithStack(err)
+}
+
+// VODChapters returns the chapters of the VOD "vURL" from its chapter
+// markers. The chapter of a VOD without markers spans the whole VOD and is
+// named after its game.
+func VODChapters(ctx context.Context, client *http.Client, clientID, vURL string) ([]Chapter, error) {
+	id, vType, err := twitch.ID(vURL)
+	if err != nil {
+		return nil, err
+	}
+	if vType != twitch.TypeVOD {
+		return nil, errors.Errorf("chapters are only supported for VODs: %s", vURL)
+	}
+	api := twitch.New(client, clientID)
+	markers, err := api.Chapters(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var chapters []Chapter
+	for _, m := range markers {
+		chapters = append(chapters, Chapter{
+			Title: m.Title,
+			Game:  m.Game.DisplayName,
+			Start: m.Offset(),
+			End:   m.Offset() + m.Duration(),
+		})
+	}
+	if len(chapters) > 0 {
+		return chapters, nil
+	}
+	vod, err := api.VOD(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(vod.Game.DisplayName) == 0 {
+		return nil, nil
+	}
+	return []Chapter{{Title: vod.Game.DisplayName, Game: vod.Game.DisplayName, End: vod.Duration()}}, nil
+}
+
+// MatchChapters returns the chapters whose title or game is name, ignoring
+// case.
+func MatchChapters(chapters []Chapter, name string) []Chapter {
+	var matched []Chapter
+	for _, c := range chapters {
+		if strings.EqualFold(c.Title, name) || strings.EqualFold(c.Game, name) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+// ChapterRanges returns the ranges of chapters. Consecutive chapters are
+// merged into a single range.
+func ChapterRanges(chapters []Chapter) []Range {
+	var ranges []Range
+	for _, c := range chapters {
+		if n := len(ranges); n > 0 && ranges[n-1].End == c.Start {
+			ranges[n-1].End = c.End
+			continue
+		}
+		ranges = append(ranges, Range{Start: c.Start, End: c.End})
+	}
+	return ranges
+}
+
+// ClipChapters returns the chapters of a download made of ranges one after
+// the other: chapters are cut to the ranges and their positions are relative
+// to the start of the download.
+func ClipChapters(chapters []Chapter, ranges []Range) []Chapter {
+	var clipped []Chapter
+	var offset time.Duration
+	for _, r := range ranges {
+		for _, c := range chapters {
+			start, end := c.Start, c.End
+			if start < r.Start {
+				start = r.Start
+			}
+			if end > r.End {
+				end = r.End
+			}
+			if start >= end {
+				continue
+			}
+			c.Start, c.End = offset+start-r.Start, offset+end-r.Start
+			clipped = append(clipped, c)
+		}
+		offset += r.End - r.Start
+	}
+	return clipped
+}
@@ -0,0 +1,84 @@
+package twitchdl
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFFMetadata(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteFFMetadata(&b, "Owner - Playlist", []Chapter{
+		{Title: "First", Start: 0, End: 20 * time.Second},
+		{Title: "a=b;c", Start: 20 * time.Second, End: 50*time.Second + 500*time.Millisecond},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `;FFMETADATA1
+title=Owner - Playlist
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=20000
+title=First
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=20000
+END=50500
+title=a\=b\;c
+`, b.String())
+}
+
+func TestDownloadChapter(t *testing.T) {
+	client := testClient(t, fakeTwitch(t, map[string]fakeVOD{"1": {segments: 6}}, map[string]string{
+		"query VideoChapters": `{"data":{"video":{"moments":{"edges":[
+			{"node":{"description":"Elden Ring","positionMilliseconds":0,"durationMilliseconds":20000,"details":{"game":{"displayName":"Elden Ring"}}}},
+			{"node":{"description":"Just Chatting","positionMilliseconds":20000,"durationMilliseconds":20000,"details":{"game":{"displayName":"Just Chatting"}}}},
+			{"node":{"description":"Elden Ring","positionMilliseconds":40000,"durationMilliseconds":20000,"details":{"game":{"displayName":"Elden Ring"}}}}
+		]}}}}`,
+	}))
+
+	chapters, err := VODChapters(context.Background(), client, "", "https://www.twitch.tv/videos/1")
+	require.NoError(t, err)
+	assert.Equal(t, Chapter{Title: "Just Chatting", Game: "Just Chatting", Start: 20 * time.Second, End: 40 * time.Second}, chapters[1])
+
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Chapter: "elden ring"})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1-0;1-1;1-4;1-5;", string(b))
+	assert.Equal(t, []Range{{0, 20 * time.Second}, {40 * time.Second, time.Minute}}, stream.Info().Ranges)
+
+	_, err = DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Chapter: "Tetris"})
+	assert.Error(t, err)
+}
+
+func TestVODChaptersWithoutMarkers(t *testing.T) {
+	client := testClient(t, gqlHandler(t, map[string]string{
+		"query VideoChapters": `{"data":{"video":{"moments":{"edges":[]}}}}`,
+		"query VOD":           `{"data":{"video":{"id":"1","lengthSeconds":3600,"game":{"displayName":"Tetris"}}}}`,
+	}))
+	chapters, err := VODChapters(context.Background(), client, "", "https://www.twitch.tv/videos/1")
+	require.NoError(t, err)
+	assert.Equal(t, []Chapter{{Title: "Tetris", Game: "Tetris", End: time.Hour}}, chapters)
+}
+
+func TestClipChapters(t *testing.T) {
+	chapters := []Chapter{
+		{Title: "A", Start: 0, End: 10 * time.Minute},
+		{Title: "B", Start: 10 * time.Minute, End: 30 * time.Minute},
+		{Title: "C", Start: 30 * time.Minute, End: time.Hour},
+	}
+	assert.Equal(t, []Range{{0, 30 * time.Minute}}, ChapterRanges(chapters[:2]))
+	assert.Equal(t, []Chapter{
+		{Title: "A", Start: 0, End: 5 * time.Minute},
+		{Title: "B", Start: 5 * time.Minute, End: 10 * time.Minute},
+		{Title: "C", Start: 10 * time.Minute, End: 20 * time.Minute},
+	}, ClipChapters(chapters, []Range{{5 * time.Minute, 15 * time.Minute}, {50 * time.Minute, time.Hour}}))
+}
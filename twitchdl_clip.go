@@ -3,9 +3,9 @@ package twitchdl
 import (
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/jybp/twitch-downloader/twitch"
 	"github.com/pkg/errors"
@@ -13,22 +13,65 @@ import (
 
 const clipQualityFramerateFormat = "%sp%.f"
 
-func downloadClip(ctx context.Context, client *http.Client, clientID, id, quality string) (io.ReadCloser, error) {
+// ErrSourceVODUnavailable is returned when the VOD a clip was taken from has
+// expired or has been deleted.
+var ErrSourceVODUnavailable = errors.New("source VOD is no longer available")
+
+// ClipContext returns the URL of the VOD the clip "vURL" was taken from and
+// the range of that VOD covering the clip extended by padding on both sides,
+// clamped to the VOD.
+func ClipContext(ctx context.Context, client *http.Client, clientID, vURL string, padding time.Duration) (vodURL string, start, end time.Duration, _ error) {
+	id, vType, err := twitch.ID(vURL)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if vType != twitch.TypeClip {
+		return "", 0, 0, errors.Errorf("%s is not a clip", vURL)
+	}
+	api := twitch.New(client, clientID)
+	clip, err := api.Clip(ctx, id)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if len(clip.VideoID) == 0 {
+		return "", 0, 0, errors.Wrapf(ErrSourceVODUnavailable, "clip %s", id)
+	}
+	vod, err := api.VOD(ctx, clip.VideoID)
+	if errors.Cause(err) == twitch.ErrNotFound {
+		return "", 0, 0, errors.Wrapf(ErrSourceVODUnavailable, "clip %s: VOD %s", id, clip.VideoID)
+	}
+	if err != nil {
+		return "", 0, 0, err
+	}
+	start = clip.VideoOffset() - padding
+	if start < 0 {
+		start = 0
+	}
+	end = clip.VideoOffset() + clip.Duration() + padding
+	if d := vod.Duration(); d > 0 && end > d {
+		end = d
+	}
+	return fmt.Sprintf("https://www.twitch.tv/videos/%s", clip.VideoID), start, end, nil
+}
+
+func downloadClip(ctx context.Context, client *http.Client, clientID, id, quality string) (*Stream, error) {
 	api := twitch.New(client, clientID)
 	clip, err := api.ClipVideo(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	var dlURL string
+	var dlURL, name string
 	for _, q := range clip.Qualities {
 		str := fmt.Sprintf(clipQualityFramerateFormat, q.Quality, q.FrameRate)
-		if str != quality {
+		if str != quality && quality != QualityBest {
 			continue
 		}
+		name = str
 		dlURL = fmt.Sprintf("%s?sig=%s&token=%s",
 			q.SourceURL,
 			url.QueryEscape(clip.Token.Signature),
 			url.QueryEscape(clip.Token.Value))
+		break
 	}
 	if len(dlURL) == 0 {
 		return nil, errors.Errorf("Quality %s not found", quality)
@@ -40,10 +83,10 @@ func downloadClip(ctx context.Context, client *http.Client, clientID, id, qualit
 	req = req.WithContext(ctx)
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, errors.WithStack(twitch.RedactError(err))
 	}
 	if s := resp.StatusCode; s < 200 || s >= 300 {
-		return nil, errors.Errorf("%d: %s", s, req.URL)
+		return nil, errors.Errorf("%d: %s", s, twitch.RedactURL(req.URL.String()))
 	}
-	return resp.Body, nil
+	return &Stream{ReadCloser: resp.Body, info: Info{Quality: name}}, nil
 }
@@ -0,0 +1,56 @@
+package twitchdl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// Collection retrieves the collection "vURL" and its VODs, in order.
+func Collection(ctx context.Context, client *http.Client, clientID, vURL string) (twitch.Collection, error) {
+	id, vType, err := twitch.ID(vURL)
+	if err != nil {
+		return twitch.Collection{}, err
+	}
+	if vType != twitch.TypeCollection {
+		return twitch.Collection{}, errors.Errorf("%s is not a collection", vURL)
+	}
+	api := twitch.New(client, clientID)
+	return api.Collection(ctx, id)
+}
+
+// DownloadCollection sets up the download of every VOD of the collection
+// "vURL" merged into a single stream. The returned chapters mark the
+// boundaries between VODs. opts.Start and opts.End are ignored.
+// Each VOD is only resolved once the download reaches it.
+func DownloadCollection(ctx context.Context, client *http.Client, clientID, vURL string, opts Options) (io.ReadCloser, []Chapter, error) {
+	collection, err := Collection(ctx, client, clientID, vURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(collection.VODs) == 0 {
+		return nil, nil, errors.Errorf("collection %s is empty", collection.ID)
+	}
+	var downloadFns []downloadFunc
+	var chapters []Chapter
+	var offset time.Duration
+	for _, vod := range collection.VODs {
+		id := vod.ID
+		downloadFns = append(downloadFns, func() (io.ReadCloser, error) {
+			opts := opts
+			opts.Start, opts.End, opts.Duration, opts.Resume, opts.Ranges, opts.Chapter = 0, 0, 0, 0, nil, ""
+			stream, err := downloadVOD(ctx, client, clientID, id, opts)
+			if err != nil {
+				return nil, err
+			}
+			return stream, nil
+		})
+		chapters = append(chapters, Chapter{Title: vod.Title, Start: offset, End: offset + vod.Duration()})
+		offset += vod.Duration()
+	}
+	return &merger{ctx: ctx, downloads: downloadFns, skip: opts.Resume}, chapters, nil
+}
@@ -0,0 +1,34 @@
+package twitchdl
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadCollection(t *testing.T) {
+	client := testClient(t, fakeTwitch(t,
+		map[string]fakeVOD{"1": {segments: 2}, "2": {segments: 3}},
+		map[string]string{
+			"query Collection": `{"data":{"collection":{"id":"abc","title":"Playlist","items":{"edges":[
+				{"cursor":"c1","node":{"id":"1","title":"First","lengthSeconds":20}},
+				{"cursor":"c2","node":{"id":"2","title":"Second","lengthSeconds":30}}
+			],"pageInfo":{"hasNextPage":false}}}}}`,
+		}))
+
+	download, chapters, err := DownloadCollection(context.Background(), client, "clientID",
+		"https://www.twitch.tv/collections/abc", Options{Quality: "720p30"})
+	require.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{Title: "First", Start: 0, End: 20 * time.Second},
+		{Title: "Second", Start: 20 * time.Second, End: 50 * time.Second},
+	}, chapters)
+
+	b, err := ioutil.ReadAll(download)
+	require.NoError(t, err)
+	assert.Equal(t, "1-0;1-1;2-0;2-1;2-2;", string(b))
+}
@@ -0,0 +1,276 @@
+package twitchdl
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultTemplate is the filename template used when none is specified.
+const DefaultTemplate = "{channel} - {title} ({quality}).{ext}"
+
+// maxElementLength is the maximum length in bytes of a file or directory
+// name on most filesystems.
+const maxElementLength = 255
+
+// Fields are the values of the placeholders of a filename template.
+type Fields struct {
+	Channel string        // {channel}
+	Login   string        // {login}
+	Title   string        // {title}
+	ID      string        // {id}
+	Date    time.Time     // {date} or {date:layout}
+	Game    string        // {game}
+	Quality string        // {quality}
+	Start   time.Duration // {start}
+	End     time.Duration // {end}
+	Part    int           // {part}, the number of a part such as "01"
+	Ext     string        // {ext}
+}
+
+// Fields returns the template fields describing m.
+// Quality and Ext are left empty. End defaults to the duration of the video.
+func (m Metadata) Fields() Fields {
+	var f Fields
+	switch {
+	case m.VOD != nil:
+		f = Fields{
+			Channel: m.VOD.Owner.DisplayName,
+			Login:   m.VOD.Owner.Login,
+			Title:   m.VOD.Title,
+			ID:      m.VOD.ID,
+			Date:    m.VOD.CreatedAt,
+			Game:    m.VOD.Game.Name,
+			End:     m.VOD.Duration(),
+		}
+	case m.Clip != nil:
+		f = Fields{
+			Channel: m.Clip.Broadcaster.DisplayName,
+			Login:   m.Clip.Broadcaster.Login,
+			Title:   m.Clip.Title,
+			ID:      m.Clip.Slug,
+			Date:    m.Clip.CreatedAt,
+			Game:    m.Clip.Game.Name,
+			End:     m.Clip.Duration(),
+		}
+		if len(f.ID) == 0 {
+			f.ID = m.Clip.ID
+		}
+	case m.Collection != nil:
+		f = Fields{
+			Channel: m.Collection.Owner.DisplayName,
+			Login:   m.Collection.Owner.Login,
+			Title:   m.Collection.Title,
+			ID:      m.Collection.ID,
+			Date:    m.Collection.UpdatedAt,
+		}
+		for _, vod := range m.Collection.VODs {
+			f.End += vod.Duration()
+		}
+	case len(m.Source) > 0:
+		f = playlistFields(m.Source)
+	}
+	return f
+}
+
+// Filename expands the placeholders of template with f.
+// Elements of template separated by "/" outside placeholders become
+// directories, values never do: "{date:2006/01/02}" expands to "2021_03_04"
+// while "{date:2006}/{date:01}" expands to "2021/03". "." and ".." elements
+// of template are kept as is, every other file and directory name is made
+// safe for common filesystems: forbidden characters, control characters and
+// emoji are removed or replaced, Unicode is normalized to NFC, reserved
+// Windows names are escaped and lengths are limited.
+// The returned path uses the OS path separator.
+func Filename(template string, f Fields) (string, error) {
+	elems := splitTemplate(template)
+	for i, elem := range elems {
+		if len(elem) == 0 || (i == 0 && elem == filepath.VolumeName(elem)) {
+			// Leading, trailing or double slashes and Windows volumes.
+			continue
+		}
+		if elem == "." || elem == ".." {
+			// Relative directories written in template, not in values.
+			continue
+		}
+		expanded, err := expand(elem, f)
+		if err != nil {
+			return "", err
+		}
+		elems[i] = sanitize(expanded, i < len(elems)-1)
+	}
+	p := path.Clean(strings.Join(elems, "/"))
+	return filepath.FromSlash(p), nil
+}
+
+// splitTemplate splits template on the slashes outside placeholders.
+func splitTemplate(template string) []string {
+	var elems []string
+	depth, last := 0, 0
+	for i := 0; i < len(template); i++ {
+		switch template[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case '/':
+			if depth == 0 {
+				elems = append(elems, template[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(elems, template[last:])
+}
+
+// expand replaces the placeholders of elem with the sanitized values of f.
+func expand(elem string, f Fields) (string, error) {
+	var b strings.Builder
+	for len(elem) > 0 {
+		open := strings.IndexByte(elem, '{')
+		if open == -1 {
+			b.WriteString(elem)
+			break
+		}
+		b.WriteString(elem[:open])
+		closing := strings.IndexByte(elem[open:], '}')
+		if closing == -1 {
+			return "", errors.Errorf("unclosed placeholder in %q", elem)
+		}
+		name := elem[open+1 : open+closing]
+		value, err := placeholder(name, f)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(sanitizeValue(value))
+		elem = elem[open+closing+1:]
+	}
+	return b.String(), nil
+}
+
+func placeholder(name string, f Fields) (string, error) {
+	if strings.HasPrefix(name, "date:") {
+		return f.Date.Format(name[5:]), nil
+	}
+	switch name {
+	case "channel":
+		return f.Channel, nil
+	case "login":
+		return f.Login, nil
+	case "title":
+		return f.Title, nil
+	case "id":
+		return f.ID, nil
+	case "date":
+		return f.Date.Format("2006-01-02"), nil
+	case "game":
+		return f.Game, nil
+	case "quality":
+		return f.Quality, nil
+	case "start":
+		return formatTimestamp(f.Start), nil
+	case "end":
+		return formatTimestamp(f.End), nil
+	case "part":
+		return fmt.Sprintf("%02d", f.Part), nil
+	case "ext":
+		return f.Ext, nil
+	default:
+		return "", errors.Errorf("unknown placeholder {%s}", name)
+	}
+}
+
+// formatTimestamp formats d as "1h02m03s".
+func formatTimestamp(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+	return fmt.Sprintf("%dh%02dm%02ds", h, m, s)
+}
+
+// sanitizeValue prevents a placeholder value from introducing separators.
+func sanitizeValue(v string) string {
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(v)
+}
+
+// windowsReserved are file names that cannot be used on Windows, with or
+// without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitize makes elem a valid file or directory name.
+func sanitize(elem string, dir bool) string {
+	elem = norm.NFC.String(elem)
+	var b strings.Builder
+	space := false
+	for _, r := range elem {
+		switch {
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			r = '_'
+		case r == utf8.RuneError,
+			unicode.Is(unicode.Cc, r),
+			unicode.Is(unicode.Cf, r),
+			unicode.Is(unicode.So, r),
+			unicode.Is(unicode.Co, r),
+			unicode.Is(unicode.Variation_Selector, r):
+			continue
+		}
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	// Windows does not allow trailing dots and spaces.
+	elem = strings.TrimRight(b.String(), ". ")
+	if elem == "" || elem == "." || elem == ".." {
+		return "_"
+	}
+
+	ext := ""
+	if !dir {
+		ext = path.Ext(elem)
+		if len(ext) > 16 {
+			ext = ""
+		}
+	}
+	base := strings.TrimSuffix(elem, ext)
+	if windowsReserved[strings.ToUpper(strings.SplitN(base, ".", 2)[0])] {
+		base = "_" + base
+	}
+	if len(base)+len(ext) > maxElementLength {
+		base = truncate(base, maxElementLength-len(ext))
+		base = strings.TrimRight(base, ". ")
+	}
+	return base + ext
+}
+
+// truncate shortens s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,135 @@
+package twitchdl
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilename(t *testing.T) {
+	fields := Fields{
+		Channel: "Owner",
+		Login:   "owner",
+		Title:   "Title",
+		ID:      "12345",
+		Date:    time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Game:    "Game",
+		Quality: "1080p60",
+		Start:   time.Minute,
+		End:     time.Hour + 2*time.Minute + 3*time.Second,
+		Part:    3,
+		Ext:     "ts",
+	}
+	tcs := []struct {
+		template    string
+		title       string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			template: DefaultTemplate,
+			expected: "Owner - Title (1080p60).ts",
+		},
+		{
+			template: "{login}/{date}/{id} {start}-{end}.{ext}",
+			expected: "owner/2021-03-04/12345 0h01m00s-1h02m03s.ts",
+		},
+		{
+			template: "{date:2006/01/02} {title}.{ext}",
+			expected: "2021_03_04 Title.ts",
+		},
+		{
+			template: "{date:2006}/{date:01}/{title}.{ext}",
+			expected: "2021/03/Title.ts",
+		},
+		{
+			template: "{id} part {part}.{ext}",
+			expected: "12345 part 03.ts",
+		},
+		{
+			template: "/archive/{game}/{date:2006-01-02 15:04} {title}.{ext}",
+			expected: "/archive/Game/2021-03-04 05_06 Title.ts",
+		},
+		{
+			template: "{title}.{ext}",
+			title:    "a/b: c? \"d\" <e>|*",
+			expected: "a_b_ c_ _d_ _e___.ts",
+		},
+		{
+			template: "{title}.{ext}",
+			title:    "🔴 LIVE  now ✨\t!",
+			expected: "LIVE now !.ts",
+		},
+		{
+			template: "{title}.{ext}",
+			title:    "Café",
+			expected: "Café.ts",
+		},
+		{
+			template: "{title}",
+			title:    "con",
+			expected: "_con",
+		},
+		{
+			template: "{title}/{id}",
+			title:    "..",
+			expected: "_/12345",
+		},
+		{
+			template: "./{title}.{ext}",
+			expected: "Title.ts",
+		},
+		{
+			template: "../out/{title}.{ext}",
+			expected: "../out/Title.ts",
+		},
+		{
+			template: "/tmp/../x/{title}.{ext}",
+			expected: "/x/Title.ts",
+		},
+		{
+			template: "../dl/{title}/../{id}.{ext}",
+			expected: "../dl/12345.ts",
+		},
+		{
+			template: "{title}",
+			title:    "trailing. . ",
+			expected: "trailing",
+		},
+		{
+			template:    "{unknown}",
+			expectedErr: true,
+		},
+		{
+			template:    "{title",
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.template+tc.title, func(t *testing.T) {
+			f := fields
+			if len(tc.title) > 0 {
+				f.Title = tc.title
+			}
+			actual, err := Filename(tc.template, f)
+			if tc.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, filepath.FromSlash(tc.expected), actual)
+		})
+	}
+}
+
+func TestFilenameLength(t *testing.T) {
+	f := Fields{Title: strings.Repeat("é", 200), Ext: "ts"}
+	actual, err := Filename("{title}.{ext}", f)
+	require.NoError(t, err)
+	assert.True(t, len(actual) <= maxElementLength, "%d", len(actual))
+	assert.True(t, strings.HasSuffix(actual, "é.ts"))
+}
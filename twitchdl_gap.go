@@ -0,0 +1,290 @@
+package twitchdl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/pkg/errors"
+)
+
+// GapFill is the strategy applied to the segments of a VOD whose download
+// still fails after Options.Retries.
+type GapFill string
+
+// Gap fill strategies.
+const (
+	// GapFail fails the download.
+	GapFail GapFill = ""
+	// GapVariant downloads the segment from the next best variant having it
+	// and fails the download if none has it.
+	GapVariant GapFill = "variant"
+	// GapSkip leaves the segment out of the download. MPEG-TS packets
+	// flagging a discontinuity on the streams of the previous segments take
+	// its place so that players do not expect continuous timestamps.
+	GapSkip GapFill = "skip"
+)
+
+// Gap is a segment of a VOD that could not be downloaded from the variant
+// of the download.
+type Gap struct {
+	// Segment is the number of the media segment.
+	Segment int
+	// Start and End are the range of the VOD covered by the segment.
+	Start, End time.Duration
+	// Quality is the quality of the variant the segment was downloaded from
+	// instead. It is empty when the segment was left out.
+	Quality string
+}
+
+// gaps records the gaps of a download as they are filled.
+type gaps struct {
+	mu   sync.Mutex
+	list []Gap
+}
+
+func (g *gaps) add(gap Gap) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.list = append(g.list, gap)
+}
+
+func (g *gaps) all() []Gap {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]Gap(nil), g.list...)
+}
+
+// filler returns the func filling the gap left by the segment at index of
+// segments according to opts.GapFill. It returns nil for GapFail. With
+// GapSkip, pids are the PIDs of the segments read so far.
+func (p playlist) filler(ctx context.Context, client *http.Client, segments []m3u8.MediaSegment, opts Options, g *gaps, keys *keyCache, pids *tsPIDs) (func(index int, err error) (io.ReadCloser, error), error) {
+	switch opts.GapFill {
+	case GapFail:
+		return nil, nil
+	case GapVariant, GapSkip:
+	default:
+		return nil, errors.Errorf("unknown gap fill strategy %q", opts.GapFill)
+	}
+	var once sync.Once
+	var alternatives []playlist
+	return func(index int, err error) (io.ReadCloser, error) {
+		segment := segments[index]
+		start := p.offset(segment.Number)
+		gap := Gap{Segment: segment.Number, Start: start, End: start + segment.Duration}
+		var body io.ReadCloser
+		if opts.GapFill == GapVariant {
+			once.Do(func() { alternatives = p.alternatives(ctx, client) })
+			body, gap.Quality = downloadFrom(ctx, client, keys, alternatives, segment.Number)
+			if body == nil {
+				return nil, errors.Wrapf(err, "segment %d is missing from every variant", segment.Number)
+			}
+		} else {
+			body = ioutil.NopCloser(bytes.NewReader(discontinuity(pids.all())))
+		}
+		g.add(gap)
+		if opts.Events != nil {
+			opts.Events(Event{Type: EventGap, Segment: index, Segments: len(segments), Quality: gap.Quality, Err: err})
+		}
+		return body, nil
+	}, nil
+}
+
+// alternatives returns the media playlists of the other variants of the
+// master playlist from the next best to the best. Variants whose playlist
+// cannot be fetched are left out, as well as audio only variants unless the
+// variant of p is audio only.
+func (p playlist) alternatives(ctx context.Context, client *http.Client) []playlist {
+	index := -1
+	for i, v := range p.master.Variants {
+		if v.URL == p.variant.URL {
+			index = i
+		}
+	}
+	var order []m3u8.Variant
+	order = append(order, p.master.Variants[index+1:]...)
+	for i := index - 1; i >= 0; i-- {
+		order = append(order, p.master.Variants[i])
+	}
+	var alternatives []playlist
+	for _, v := range order {
+		if audioOnly(v) != audioOnly(p.variant) {
+			continue
+		}
+		media, err := fetchMedia(ctx, client, v.URL)
+		if err != nil {
+			continue
+		}
+		quality := ""
+		if len(v.Alternatives) > 0 {
+			quality = v.Alternatives[0].Name
+		}
+		alternatives = append(alternatives, playlist{quality: quality, variant: v, media: media})
+	}
+	return alternatives
+}
+
+// downloadFrom downloads the segment "number" from the first playlist having
+// it and returns its content, decrypted with keys, along with the quality of
+// the playlist. It returns a nil io.ReadCloser if no playlist has it.
+func downloadFrom(ctx context.Context, client *http.Client, keys *keyCache, playlists []playlist, number int) (io.ReadCloser, string) {
+	for _, p := range playlists {
+		for _, segment := range p.media.Segments {
+			if segment.Number != number {
+				continue
+			}
+			req, err := http.NewRequest(http.MethodGet, segment.URL, nil)
+			if err != nil {
+				break
+			}
+			req = req.WithContext(withSegment(ctx, number))
+			download, _, err := keys.decrypt(ctx, client, segment, prepare(client, req), nil)
+			if err != nil {
+				break
+			}
+			if body, err := download(); err == nil {
+				return body, p.quality
+			}
+			break
+		}
+	}
+	return nil, ""
+}
+
+// audioOnly reports whether v has no video such as the "audio_only" variant
+// of twitch VODs.
+func audioOnly(v m3u8.Variant) bool {
+	if v.Video == "audio_only" {
+		return true
+	}
+	if len(v.Codecs) == 0 {
+		return false
+	}
+	for _, codec := range v.Codecs {
+		switch strings.SplitN(strings.TrimSpace(codec), ".", 2)[0] {
+		case "mp4a", "ac-3", "ec-3", "opus", "fLaC":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// tsPacketSize is the size of an MPEG-TS packet.
+const tsPacketSize = 188
+
+// tsPIDs records the PIDs of the MPEG-TS packets of a download.
+type tsPIDs struct {
+	mu   sync.Mutex
+	pids map[uint16]bool
+}
+
+func (t *tsPIDs) add(pid uint16) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pids == nil {
+		t.pids = map[uint16]bool{}
+	}
+	t.pids[pid] = true
+}
+
+// all returns the PIDs in ascending order.
+func (t *tsPIDs) all() []uint16 {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var pids []uint16
+	for pid := range t.pids {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	return pids
+}
+
+// wrap returns download recording the PIDs of the packets it reads.
+func (t *tsPIDs) wrap(download downloadFunc) downloadFunc {
+	return func() (io.ReadCloser, error) {
+		body, err := download()
+		if err != nil {
+			return nil, err
+		}
+		return &pidReader{ReadCloser: body, pids: t}, nil
+	}
+}
+
+// pidReader records the PIDs of the MPEG-TS packets read through it.
+type pidReader struct {
+	io.ReadCloser
+	pids *tsPIDs
+	seen map[uint16]bool
+	// off is the position in the current packet.
+	off    int
+	header [3]byte
+}
+
+func (r *pidReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	for i := 0; i < n; {
+		if r.off < len(r.header) {
+			r.header[r.off] = b[i]
+			r.off++
+			i++
+			if r.off == len(r.header) && r.header[0] == 0x47 {
+				r.record(uint16(r.header[1]&0x1f)<<8 | uint16(r.header[2]))
+			}
+			continue
+		}
+		skip := tsPacketSize - r.off
+		if skip > n-i {
+			skip = n - i
+		}
+		r.off += skip
+		i += skip
+		if r.off == tsPacketSize {
+			r.off = 0
+		}
+	}
+	return n, err
+}
+
+func (r *pidReader) record(pid uint16) {
+	// Null packets only stuff the stream.
+	if pid == 0x1fff || r.seen[pid] {
+		return
+	}
+	if r.seen == nil {
+		r.seen = map[uint16]bool{}
+	}
+	r.seen[pid] = true
+	r.pids.add(pid)
+}
+
+// discontinuity returns an MPEG-TS packet for each of pids holding only an
+// adaptation field whose discontinuity_indicator is set.
+func discontinuity(pids []uint16) []byte {
+	b := make([]byte, 0, len(pids)*tsPacketSize)
+	for _, pid := range pids {
+		packet := make([]byte, tsPacketSize)
+		packet[0] = 0x47
+		packet[1] = byte(pid >> 8 & 0x1f)
+		packet[2] = byte(pid)
+		// Adaptation field only, continuity counter 0.
+		packet[3] = 0x20
+		packet[4] = tsPacketSize - 5
+		packet[5] = 0x80
+		for i := 6; i < tsPacketSize; i++ {
+			packet[i] = 0xff
+		}
+		b = append(b, packet...)
+	}
+	return b
+}
@@ -0,0 +1,136 @@
+package twitchdl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGapFill(t *testing.T) {
+	h := fakeTwitch(t, map[string]fakeVOD{"1": {segments: 4}}, nil)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1/720p30/2.ts" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h(w, r)
+	}))
+
+	tcs := []struct {
+		fill     GapFill
+		expected string
+		gaps     []Gap
+		err      bool
+	}{
+		{fill: GapFail, err: true},
+		{fill: GapVariant, expected: "1-0;1-1;1-2;1-3;", gaps: []Gap{{Segment: 2, Start: 20 * time.Second, End: 30 * time.Second, Quality: "1080p60"}}},
+		{fill: GapSkip, expected: "1-0;1-1;1-3;", gaps: []Gap{{Segment: 2, Start: 20 * time.Second, End: 30 * time.Second}}},
+	}
+	for _, tc := range tcs {
+		t.Run(string(tc.fill), func(t *testing.T) {
+			var events []Event
+			stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", RetryDelay: time.Millisecond, GapFill: tc.fill, Events: func(e Event) {
+				if e.Type == EventGap {
+					events = append(events, e)
+				}
+			}})
+			require.NoError(t, err)
+			b, err := ioutil.ReadAll(stream)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(b))
+			assert.Equal(t, tc.gaps, stream.Info().Gaps)
+			require.Len(t, events, 1)
+			assert.Equal(t, 2, events[0].Segment)
+			assert.Equal(t, tc.gaps[0].Quality, events[0].Quality)
+		})
+	}
+
+	_, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", GapFill: "nope"})
+	assert.Error(t, err)
+}
+
+// tsPacket returns an MPEG-TS packet of pid.
+func tsPacket(pid uint16) []byte {
+	packet := bytes.Repeat([]byte{0xff}, tsPacketSize)
+	packet[0], packet[1], packet[2], packet[3] = 0x47, byte(pid>>8), byte(pid), 0x10
+	return packet
+}
+
+func TestGapSkipDiscontinuity(t *testing.T) {
+	h := fakeTwitch(t, map[string]fakeVOD{"1": {segments: 3}}, nil)
+	segment := append(append(tsPacket(0x100), tsPacket(0x101)...), tsPacket(0x1fff)...)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1/720p30/1.ts":
+			w.WriteHeader(http.StatusNotFound)
+		case "/1/720p30/0.ts", "/1/720p30/2.ts":
+			w.Write(segment)
+		default:
+			h(w, r)
+		}
+	}))
+
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", RetryDelay: time.Millisecond, GapFill: GapSkip})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	require.Len(t, b, 8*tsPacketSize)
+	assert.Equal(t, segment, b[:3*tsPacketSize])
+	assert.Equal(t, discontinuity([]uint16{0x100, 0x101}), b[3*tsPacketSize:5*tsPacketSize])
+	assert.Equal(t, segment, b[5*tsPacketSize:])
+
+	marker := b[3*tsPacketSize : 4*tsPacketSize]
+	assert.Equal(t, []byte{0x47, 0x01, 0x00, 0x20, 183, 0x80}, marker[:6])
+}
+
+func TestPIDReader(t *testing.T) {
+	data := append(append(tsPacket(0x100), tsPacket(0x1fff)...), tsPacket(0x1011)...)
+	pids := &tsPIDs{}
+	// Reading a byte at a time splits the packet headers.
+	r := &pidReader{ReadCloser: ioutil.NopCloser(iotest.OneByteReader(bytes.NewReader(data))), pids: pids}
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, b)
+	assert.Equal(t, []uint16{0x100, 0x1011}, pids.all())
+}
+
+func TestAlternatives(t *testing.T) {
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, hlsMedia(1))
+	}))
+	p := playlist{
+		master: m3u8.MasterPlaylist{Variants: []m3u8.Variant{
+			{URL: "https://cdn.test/chunked.m3u8", Alternatives: []m3u8.Alternative{{Name: "1080p60"}}},
+			{URL: "https://cdn.test/720p30.m3u8", Alternatives: []m3u8.Alternative{{Name: "720p30"}}},
+			{URL: "https://cdn.test/audio_only.m3u8", Video: "audio_only", Codecs: []string{"mp4a.40.2"}, Alternatives: []m3u8.Alternative{{Name: "Audio Only"}}},
+			{URL: "https://cdn.test/360p30.m3u8", Codecs: []string{"avc1.4D401E", "mp4a.40.2"}, Alternatives: []m3u8.Alternative{{Name: "360p30"}}},
+		}},
+	}
+	qualities := func(alternatives []playlist) []string {
+		var names []string
+		for _, a := range alternatives {
+			names = append(names, a.quality)
+		}
+		return names
+	}
+
+	p.variant = p.master.Variants[1]
+	assert.Equal(t, []string{"360p30", "1080p60"}, qualities(p.alternatives(context.Background(), client)))
+	p.variant = p.master.Variants[2]
+	assert.Empty(t, qualities(p.alternatives(context.Background(), client)))
+	assert.True(t, audioOnly(m3u8.Variant{Codecs: []string{"mp4a.40.2"}}))
+	assert.False(t, audioOnly(m3u8.Variant{}))
+}
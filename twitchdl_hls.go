@@ -0,0 +1,310 @@
+package twitchdl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// qualitySource is the quality of a media playlist without master playlist.
+const qualitySource = "source"
+
+// IsPlaylist reports whether source is an HLS playlist rather than a twitch
+// URL: the URL of a master or media playlist such as
+// "https://example.com/live/master.m3u8", a file:// URL or the path of a
+// local .m3u8 file. Playlists are downloaded like VODs.
+func IsPlaylist(source string) bool {
+	u, err := url.Parse(source)
+	if err == nil {
+		switch u.Scheme {
+		case "http", "https":
+			return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+		case "file":
+			return true
+		}
+	}
+	return strings.HasSuffix(strings.ToLower(source), ".m3u8")
+}
+
+// playlistURL returns the URL of the playlist source. Local files are
+// turned into file:// URLs.
+func playlistURL(source string) (string, error) {
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "file") {
+		return source, nil
+	}
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	p := filepath.ToSlash(abs)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String(), nil
+}
+
+// fileTransport serves file:// URLs from the local filesystem and leaves
+// other URLs to rt. Unless local is set, file:// URLs are rejected so that a
+// remote playlist, its keys or its redirects cannot read local files.
+type fileTransport struct {
+	rt    http.RoundTripper
+	local bool
+}
+
+// localFiles serves file:// URLs.
+var localFiles http.RoundTripper = fileServer{}
+
+func (t fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "file" {
+		if !t.local {
+			return nil, errors.Errorf("local file %s requested by a remote playlist", req.URL.Path)
+		}
+		return localFiles.RoundTrip(req)
+	}
+	if t.rt == nil {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	return t.rt.RoundTrip(req)
+}
+
+// fileClient returns client for the HLS playlist source. It reads file://
+// URLs only if source is a local file or a file:// URL.
+func fileClient(client *http.Client, source string) *http.Client {
+	c := *client
+	t := fileTransport{rt: client.Transport}
+	if pu, err := playlistURL(source); err == nil {
+		if u, err := url.Parse(pu); err == nil && u.Scheme == "file" {
+			t.local = true
+		}
+	}
+	c.Transport = t
+	return &c
+}
+
+// fileServer is the http.RoundTripper reading file:// URLs from the local
+// filesystem. Unlike http.NewFileTransport, it has no root directory so
+// that Windows paths such as "file:///C:/x/a.m3u8" resolve.
+type fileServer struct{}
+
+func (fileServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Proto:      "HTTP/1.0",
+		ProtoMajor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+	setStatus := func(code int) (*http.Response, error) {
+		resp.StatusCode = code
+		resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+		return resp, nil
+	}
+	f, err := os.Open(filePath(req.URL))
+	switch {
+	case os.IsNotExist(err):
+		return setStatus(http.StatusNotFound)
+	case os.IsPermission(err):
+		return setStatus(http.StatusForbidden)
+	case err != nil:
+		return nil, errors.WithStack(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+	if fi.IsDir() {
+		f.Close()
+		return setStatus(http.StatusNotFound)
+	}
+	resp.ContentLength = fi.Size()
+	if req.Method == http.MethodHead {
+		f.Close()
+	} else {
+		resp.Body = f
+	}
+	return setStatus(http.StatusOK)
+}
+
+// filePath returns the local path of the file:// URL u. The slash preceding
+// the volume of Windows paths such as "/C:/x/a.m3u8" is dropped and a host
+// other than localhost makes a UNC path.
+func filePath(u *url.URL) string {
+	p := u.Path
+	if len(p) > 1 && p[0] == '/' && len(filepath.VolumeName(filepath.FromSlash(p[1:]))) > 0 {
+		p = p[1:]
+	}
+	if len(u.Host) > 0 && u.Host != "localhost" {
+		p = "//" + u.Host + p
+	}
+	return filepath.FromSlash(p)
+}
+
+// get returns the body of u.
+func get(ctx context.Context, client *http.Client, u string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(twitch.RedactError(err))
+	}
+	defer resp.Body.Close()
+	if s := resp.StatusCode; s < 200 || s >= 300 {
+		return nil, errors.Errorf("%d: %s", s, twitch.RedactURL(u))
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	return b, errors.WithStack(err)
+}
+
+// hlsMaster returns the master playlist of source with absolute variant URLs
+// sorted from the highest to the lowest bandwidth, or the media playlist of
+// source if it has no master playlist.
+func hlsMaster(ctx context.Context, client *http.Client, source string) (*m3u8.MasterPlaylist, *m3u8.MediaPlaylist, error) {
+	u, err := playlistURL(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := get(ctx, client, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Contains(b, []byte("#EXT-X-STREAM-INF:")) {
+		media, err := m3u8.Media(bytes.NewReader(b), u)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &media, nil
+	}
+	master, err := m3u8.Master(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, err
+	}
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	for i, v := range master.Variants {
+		ref, err := url.Parse(v.URL)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		master.Variants[i].URL = base.ResolveReference(ref).String()
+	}
+	sort.SliceStable(master.Variants, func(i, j int) bool {
+		return master.Variants[i].Bandwidth > master.Variants[j].Bandwidth
+	})
+	return &master, nil, nil
+}
+
+// variantName returns the quality name of v: the name of its alternative
+// if any, such as "720p30", its height such as "720p" or its bandwidth.
+func variantName(v m3u8.Variant) string {
+	switch {
+	case len(v.Alternatives) > 0:
+		return v.Alternatives[0].Name
+	case v.Resolution.Height > 0:
+		return fmt.Sprintf("%dp", v.Resolution.Height)
+	default:
+		return fmt.Sprintf("%dk", v.Bandwidth/1000)
+	}
+}
+
+// fetchHLS fetches the media playlist of the HLS playlist source at quality.
+func fetchHLS(ctx context.Context, client *http.Client, source, quality string) (playlist, error) {
+	master, media, err := hlsMaster(ctx, client, source)
+	if err != nil {
+		return playlist{}, err
+	}
+	if media != nil {
+		if quality != QualityBest && quality != qualitySource {
+			return playlist{}, errors.Errorf("quality %s not found", quality)
+		}
+		return playlist{quality: qualitySource, media: *media}, nil
+	}
+	var variant m3u8.Variant
+	for _, v := range master.Variants {
+		if quality == QualityBest || variantName(v) == quality {
+			variant = v
+			break
+		}
+	}
+	if len(variant.URL) == 0 {
+		return playlist{}, errors.Errorf("quality %s not found", quality)
+	}
+	m, err := fetchMedia(ctx, client, variant.URL)
+	if err != nil {
+		return playlist{}, err
+	}
+	return playlist{quality: variantName(variant), master: *master, variant: variant, media: m}, nil
+}
+
+// hlsQualities returns the qualities of the HLS playlist source from the
+// best to the worst.
+func hlsQualities(ctx context.Context, client *http.Client, source string) ([]Quality, error) {
+	master, _, err := hlsMaster(ctx, fileClient(client, source), source)
+	if err != nil {
+		return nil, err
+	}
+	if master == nil {
+		return []Quality{{Name: qualitySource}}, nil
+	}
+	var qualities []Quality
+	for _, v := range master.Variants {
+		qualities = append(qualities, Quality{
+			Name:      variantName(v),
+			Width:     v.Resolution.Width,
+			Height:    v.Resolution.Height,
+			FrameRate: v.FrameRate,
+			Bandwidth: v.Bandwidth,
+			Codecs:    v.Codecs,
+		})
+	}
+	return qualities, nil
+}
+
+// downloadHLS sets up the download of the HLS playlist source.
+func downloadHLS(ctx context.Context, client *http.Client, source string, opts Options) (*Stream, error) {
+	if len(opts.Chapter) > 0 {
+		return nil, errors.New("chapters are only supported for twitch VODs")
+	}
+	client = fileClient(client, source)
+	p, err := fetchHLS(ctx, client, source, opts.Quality)
+	if err != nil {
+		return nil, err
+	}
+	return p.download(ctx, client, opts)
+}
+
+// playlistFields returns the template fields of the HLS playlist source:
+// its host or directory as channel and its filename as title and ID.
+func playlistFields(source string) Fields {
+	var dir, file string
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		dir, file = u.Host, path.Base(u.Path)
+	} else {
+		p := source
+		if err == nil && u.Scheme == "file" {
+			p = filePath(u)
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		dir, file = filepath.Base(filepath.Dir(p)), filepath.Base(p)
+	}
+	title := strings.TrimSuffix(file, path.Ext(file))
+	return Fields{Channel: dir, Title: title, ID: title}
+}
@@ -0,0 +1,207 @@
+package twitchdl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPlaylist(t *testing.T) {
+	for source, expected := range map[string]bool{
+		"https://example.com/live/master.m3u8":              true,
+		"http://example.com/index.M3U8?token=abc":           true,
+		"file:///tmp/video/index":                           true,
+		"video/index.m3u8":                                  true,
+		"https://www.twitch.tv/videos/12345":                false,
+		"https://example.com/index.m3u8.ts":                 false,
+		"https://clips.twitch.tv/AwkwardHelplessSalamander": false,
+	} {
+		assert.Equal(t, expected, IsPlaylist(source), source)
+	}
+}
+
+// hlsMedia returns a media playlist of n segments of 10 seconds.
+func hlsMedia(n int) string {
+	s := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:0\n"
+	for i := 0; i < n; i++ {
+		s += fmt.Sprintf("#EXTINF:10.000,\n%d.ts\n", i)
+	}
+	return s + "#EXT-X-ENDLIST\n"
+}
+
+func TestDownloadHLS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elems := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case r.URL.Path == "/master.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n"+
+				"low/index.m3u8\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720\n"+
+				"high/index.m3u8\n")
+		case len(elems) == 2 && elems[1] == "index.m3u8":
+			fmt.Fprint(w, hlsMedia(3))
+		case len(elems) == 2 && strings.HasSuffix(elems[1], ".ts"):
+			fmt.Fprintf(w, "%s-%s;", elems[0], strings.TrimSuffix(elems[1], ".ts"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	qualities, err := QualityDetails(ctx, srv.Client(), "", srv.URL+"/master.m3u8")
+	require.NoError(t, err)
+	require.Len(t, qualities, 2)
+	assert.Equal(t, "720p", qualities[0].Name)
+	assert.Equal(t, 1280, qualities[0].Width)
+	assert.Equal(t, "360p", qualities[1].Name)
+
+	for quality, expected := range map[string]string{
+		QualityBest: "high-1;high-2;",
+		"360p":      "low-1;low-2;",
+	} {
+		stream, err := DownloadWithOptions(ctx, srv.Client(), "", srv.URL+"/master.m3u8", Options{Quality: quality, Start: 10 * time.Second})
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(stream)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(b), quality)
+	}
+
+	streams, err := DownloadRanges(ctx, srv.Client(), "", srv.URL+"/high/index.m3u8", Options{Quality: QualityBest, Ranges: []Range{{End: 10 * time.Second}, {Start: -10 * time.Second}}})
+	require.NoError(t, err)
+	require.Len(t, streams, 2)
+	b, err := ioutil.ReadAll(streams[1])
+	require.NoError(t, err)
+	assert.Equal(t, "high-2;", string(b))
+	assert.Equal(t, qualitySource, streams[1].Info().Quality)
+
+	_, err = DownloadWithOptions(ctx, srv.Client(), "", srv.URL+"/master.m3u8", Options{Quality: "1080p"})
+	assert.Error(t, err)
+	_, err = DownloadWithOptions(ctx, srv.Client(), "", srv.URL+"/master.m3u8", Options{Quality: QualityBest, Chapter: "Intro"})
+	assert.Error(t, err)
+}
+
+func TestDownloadLocalHLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.m3u8"), []byte(hlsMedia(2)), 0644))
+	for i := 0; i < 2; i++ {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.ts", i)), []byte(fmt.Sprintf("local-%d;", i)), 0644))
+	}
+
+	source := filepath.Join(dir, "index.m3u8")
+	stream, err := DownloadWithOptions(context.Background(), http.DefaultClient, "", source, Options{Quality: QualityBest})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "local-0;local-1;", string(b))
+
+	meta, err := FetchMetadata(context.Background(), http.DefaultClient, "", source)
+	require.NoError(t, err)
+	f := meta.Fields()
+	assert.Equal(t, filepath.Base(dir), f.Channel)
+	assert.Equal(t, "index", f.Title)
+}
+
+func TestDownloadHLSRejectsLocalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	require.NoError(t, ioutil.WriteFile(secret, []byte("secret;"), 0644))
+	secretURL := "file://" + filepath.ToSlash(secret)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/segment.m3u8":
+			fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.000,\n%s\n#EXT-X-ENDLIST\n", secretURL)
+		case "/key.m3u8":
+			fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-KEY:METHOD=AES-128,URI=\"%s\"\n#EXTINF:10.000,\n0.ts\n#EXT-X-ENDLIST\n", secretURL)
+		case "/redirect.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.000,\nredirect.ts\n#EXT-X-ENDLIST\n")
+		case "/redirect.ts":
+			http.Redirect(w, r, secretURL, http.StatusFound)
+		case "/0.ts":
+			fmt.Fprint(w, "0;")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	for _, name := range []string{"segment", "key", "redirect"} {
+		stream, err := DownloadWithOptions(context.Background(), srv.Client(), "", srv.URL+"/"+name+".m3u8", Options{Quality: QualityBest})
+		if err == nil {
+			var b []byte
+			b, err = ioutil.ReadAll(stream)
+			assert.NotContains(t, string(b), "secret", name)
+		}
+		if assert.Error(t, err, name) {
+			assert.Contains(t, err.Error(), "requested by a remote playlist", name)
+		}
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	tcs := map[string]string{
+		"file:///tmp/video/index.m3u8":          "/tmp/video/index.m3u8",
+		"file://localhost/tmp/video/index.m3u8": "/tmp/video/index.m3u8",
+		"file:///C:/video/index.m3u8":           "/C:/video/index.m3u8",
+		"file://server/share/video/index.m3u8":  "//server/share/video/index.m3u8",
+		"file:///tmp/video/with%20space/0.ts":   "/tmp/video/with space/0.ts",
+	}
+	if runtime.GOOS == "windows" {
+		tcs["file:///C:/video/index.m3u8"] = `C:\video\index.m3u8`
+		tcs["file://server/share/video/index.m3u8"] = `\\server\share\video\index.m3u8`
+	}
+	for raw, expected := range tcs {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.FromSlash(expected), filePath(u), raw)
+	}
+}
+
+func TestFileServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twitchdl")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "0.ts")
+	require.NoError(t, ioutil.WriteFile(name, []byte("local-0;"), 0644))
+	fileURL, err := playlistURL(name)
+	require.NoError(t, err)
+	client := fileClient(http.DefaultClient, filepath.Join(dir, "index.m3u8"))
+
+	resp, err := client.Get(fileURL)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "local-0;", string(b))
+
+	resp, err = client.Head(fileURL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(8), resp.ContentLength)
+
+	for _, u := range []string{fileURL + ".missing", strings.TrimSuffix(fileURL, "/0.ts")} {
+		resp, err = client.Get(u)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, u)
+	}
+}
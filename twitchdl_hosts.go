@@ -0,0 +1,239 @@
+package twitchdl
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HostStats are the statistics of the segment downloads from a CDN host.
+type HostStats struct {
+	Host string
+	// Requests is the number of segment downloads from Host and Errors the
+	// number of them that failed.
+	Requests, Errors int
+	// Bytes is the number of bytes downloaded from Host during Elapsed.
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// Throughput returns the average throughput of the host in bytes per second.
+func (s HostStats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Elapsed.Seconds()
+}
+
+// hostBackoff is how long a host is avoided after a failure. It is then
+// tried first again until it succeeds or fails.
+const hostBackoff = 30 * time.Second
+
+// similarThroughput is the ratio of the best throughput above which hosts
+// take turns serving the first attempt of each segment.
+const similarThroughput = 0.8
+
+// hostPool spreads the segment downloads of a stream over CDN hosts serving
+// the same paths. Each segment is downloaded from the best host first and
+// from the other hosts in turn when it fails.
+type hostPool struct {
+	mu    sync.Mutex
+	hosts []*hostState
+	// turn rotates the hosts of similar throughput.
+	turn int
+	now  func() time.Time
+}
+
+type hostState struct {
+	stats HostStats
+	// failed is set from a failure of the host until its next success.
+	failed bool
+	// retryAt is the end of the backoff of a failed host.
+	retryAt time.Time
+}
+
+// newHostPool returns the pool of hosts. Hosts never tried are tried in the
+// order of hosts.
+func newHostPool(hosts []string) *hostPool {
+	p := &hostPool{now: time.Now}
+	for _, host := range hosts {
+		p.add(host)
+	}
+	return p
+}
+
+func (p *hostPool) add(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, h := range p.hosts {
+		if h.stats.Host == host {
+			return
+		}
+	}
+	p.hosts = append(p.hosts, &hostState{stats: HostStats{Host: host}})
+}
+
+// order returns the hosts from the best to the worst: hosts never tried and
+// failed hosts whose backoff is over first, then the other hosts from the
+// highest to the lowest throughput, those of similar throughput taking
+// turns, and finally the hosts backing off.
+func (p *hostPool) order() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	var probes, ranked, backoff []*hostState
+	for _, h := range p.hosts {
+		switch {
+		case h.failed && now.Before(h.retryAt):
+			backoff = append(backoff, h)
+		case h.failed || h.stats.Requests == 0:
+			probes = append(probes, h)
+		default:
+			ranked = append(ranked, h)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].stats.Throughput() > ranked[j].stats.Throughput()
+	})
+	similar := 0
+	for similar < len(ranked) && ranked[similar].stats.Throughput() >= similarThroughput*ranked[0].stats.Throughput() {
+		similar++
+	}
+	if similar > 1 {
+		k := p.turn % similar
+		p.turn++
+		group := append(append([]*hostState(nil), ranked[k:similar]...), ranked[:k]...)
+		copy(ranked, group)
+	}
+	sort.SliceStable(backoff, func(i, j int) bool {
+		return backoff[i].retryAt.Before(backoff[j].retryAt)
+	})
+	var hosts []string
+	for _, group := range [][]*hostState{probes, ranked, backoff} {
+		for _, h := range group {
+			hosts = append(hosts, h.stats.Host)
+		}
+	}
+	return hosts
+}
+
+// record adds the outcome of a download from host.
+func (p *hostPool) record(host string, n int64, elapsed time.Duration, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, h := range p.hosts {
+		if h.stats.Host != host {
+			continue
+		}
+		h.stats.Requests++
+		h.stats.Bytes += n
+		h.stats.Elapsed += elapsed
+		h.failed = failed
+		if failed {
+			h.stats.Errors++
+			h.retryAt = p.now().Add(hostBackoff)
+		}
+		return
+	}
+}
+
+// all returns the statistics of every host.
+func (p *hostPool) all() []HostStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]HostStats, 0, len(p.hosts))
+	for _, h := range p.hosts {
+		stats = append(stats, h.stats)
+	}
+	return stats
+}
+
+// prepare returns the downloadFunc of req trying each host of the pool, from
+// the best to the worst, with the same path. The host of req is added to the
+// pool if missing.
+func (p *hostPool) prepare(client *http.Client, req *http.Request) downloadFunc {
+	p.add(req.URL.Host)
+	return func() (io.ReadCloser, error) {
+		var err error
+		for _, host := range p.order() {
+			started := time.Now()
+			var body io.ReadCloser
+			if body, err = prepare(client, withHost(req, host))(); err != nil {
+				p.record(host, 0, time.Since(started), true)
+				continue
+			}
+			return &hostBody{ReadCloser: body, pool: p, host: host, elapsed: time.Since(started)}, nil
+		}
+		return nil, errors.Wrap(err, "every host failed")
+	}
+}
+
+// prepareSize returns the sizeFunc of req trying each host of the pool, from
+// the best to the worst, with the same path. Failures count against the
+// hosts, successes tell nothing about their throughput.
+func (p *hostPool) prepareSize(client *http.Client, req *http.Request) sizeFunc {
+	p.add(req.URL.Host)
+	return func() (int64, error) {
+		var err error
+		for _, host := range p.order() {
+			started := time.Now()
+			var n int64
+			if n, err = prepareSize(client, withHost(req, host))(); err == nil {
+				return n, nil
+			}
+			p.record(host, 0, time.Since(started), true)
+		}
+		return 0, errors.Wrap(err, "every host failed")
+	}
+}
+
+// withHost returns a copy of req sent to host.
+func withHost(req *http.Request, host string) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Host = host
+	r.URL = &u
+	r.Host = ""
+	return r
+}
+
+// hostBody records the throughput of a download once its body is read.
+// Only the time spent in the request and in reading the body counts so that
+// slow readers and bandwidth limits do not lower the throughput of the host.
+type hostBody struct {
+	io.ReadCloser
+	pool    *hostPool
+	host    string
+	elapsed time.Duration
+	n       int64
+	done    bool
+}
+
+func (b *hostBody) Read(p []byte) (int, error) {
+	started := time.Now()
+	n, err := b.ReadCloser.Read(p)
+	b.elapsed += time.Since(started)
+	b.n += int64(n)
+	if err != nil {
+		b.finish(err != io.EOF)
+	}
+	return n, err
+}
+
+func (b *hostBody) Close() error {
+	b.finish(false)
+	return b.ReadCloser.Close()
+}
+
+func (b *hostBody) finish(failed bool) {
+	if b.done {
+		return
+	}
+	b.done = true
+	b.pool.record(b.host, b.n, b.elapsed, failed)
+}
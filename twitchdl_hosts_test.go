@@ -0,0 +1,126 @@
+package twitchdl
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDownloadHosts(t *testing.T) {
+	client := testClient(t, fakeTwitch(t, map[string]fakeVOD{"1": {segments: 4}}, nil))
+	rt := client.Transport
+	var hosts []string
+	client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(req.URL.Path, ".ts") {
+			hosts = append(hosts, req.URL.Host)
+			// The original host forbids the segments.
+			if req.URL.Host == "cdn.test" {
+				return &http.Response{StatusCode: http.StatusForbidden, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+			}
+		}
+		return rt.RoundTrip(req)
+	})
+
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Hosts: []string{"alt.test"}})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1-0;1-1;1-2;1-3;", string(b))
+	// The original host is tried first, then last once it failed.
+	assert.Equal(t, []string{"cdn.test", "alt.test", "alt.test", "alt.test", "alt.test"}, hosts)
+
+	stats := stream.Info().Hosts
+	require.Len(t, stats, 2)
+	assert.Equal(t, HostStats{Host: "cdn.test", Requests: 1, Errors: 1}, HostStats{Host: stats[0].Host, Requests: stats[0].Requests, Errors: stats[0].Errors, Bytes: stats[0].Bytes})
+	assert.Equal(t, HostStats{Host: "alt.test", Requests: 4, Bytes: 16}, HostStats{Host: stats[1].Host, Requests: stats[1].Requests, Errors: stats[1].Errors, Bytes: stats[1].Bytes})
+
+	// Sizes are requested through the pool as well.
+	hosts = nil
+	stream, err = DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Hosts: []string{"alt.test"}, Resume: 6})
+	require.NoError(t, err)
+	b, err = ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1;1-2;1-3;", string(b))
+	assert.Equal(t, []string{"cdn.test", "alt.test", "alt.test", "alt.test", "alt.test", "alt.test"}, hosts)
+}
+
+func TestHostBodyElapsed(t *testing.T) {
+	p := newHostPool([]string{"a"})
+	body := &hostBody{ReadCloser: ioutil.NopCloser(strings.NewReader("abc")), pool: p, host: "a"}
+	b := make([]byte, 1)
+	_, err := body.Read(b)
+	require.NoError(t, err)
+	// Time spent by the reader between reads is not the host's.
+	time.Sleep(50 * time.Millisecond)
+	_, err = ioutil.ReadAll(body)
+	require.NoError(t, err)
+	stats := p.all()
+	assert.Equal(t, int64(3), stats[0].Bytes)
+	assert.True(t, stats[0].Elapsed < 50*time.Millisecond, stats[0].Elapsed)
+}
+
+func TestHostPoolOrder(t *testing.T) {
+	p := newHostPool([]string{"a", "b", "c"})
+	assert.Equal(t, []string{"a", "b", "c"}, p.order())
+	p.record("a", 100, time.Second, false)
+	p.record("b", 1000, time.Second, false)
+	p.record("c", 1000, time.Second, true)
+	assert.Equal(t, []string{"b", "a", "c"}, p.order())
+	p.record("d", 1000, time.Second, false)
+	assert.Len(t, p.all(), 3)
+}
+
+func TestHostPoolRecovery(t *testing.T) {
+	now := time.Now()
+	p := newHostPool([]string{"a", "b"})
+	p.now = func() time.Time { return now }
+	p.record("a", 1000, time.Second, false)
+	p.record("b", 100, time.Second, false)
+	assert.Equal(t, []string{"a", "b"}, p.order())
+
+	// The failing host is avoided during the backoff only.
+	p.record("a", 0, time.Second, true)
+	assert.Equal(t, []string{"b", "a"}, p.order())
+	now = now.Add(hostBackoff - time.Second)
+	assert.Equal(t, []string{"b", "a"}, p.order())
+	now = now.Add(time.Second)
+	assert.Equal(t, []string{"a", "b"}, p.order())
+
+	// It fails again and backs off again.
+	p.record("a", 0, time.Second, true)
+	assert.Equal(t, []string{"b", "a"}, p.order())
+	now = now.Add(hostBackoff)
+	assert.Equal(t, []string{"a", "b"}, p.order())
+
+	// It recovers and is ranked by its throughput again.
+	p.record("a", 3000, time.Second, false)
+	assert.Equal(t, []string{"a", "b"}, p.order())
+	assert.Equal(t, []string{"a", "b"}, p.order())
+}
+
+func TestHostPoolSpread(t *testing.T) {
+	p := newHostPool([]string{"a", "b", "c"})
+	p.record("a", 1000, time.Second, false)
+	p.record("b", 900, time.Second, false)
+	p.record("c", 100, time.Second, false)
+	// a and b have similar throughputs and take turns, c stays last.
+	first := map[string]int{}
+	for i := 0; i < 4; i++ {
+		order := p.order()
+		assert.Equal(t, "c", order[2])
+		first[order[0]]++
+	}
+	assert.Equal(t, map[string]int{"a": 2, "b": 2}, first)
+}
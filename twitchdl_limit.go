@@ -0,0 +1,106 @@
+package twitchdl
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limiter caps the bandwidth shared by every download using it. Its rate can
+// be changed while downloading.
+type Limiter struct {
+	mu sync.Mutex
+	// rate is in bytes per second, zero means no limit.
+	rate int64
+	// next is the time the bytes read so far are allowed at.
+	next time.Time
+}
+
+// NewLimiter returns a Limiter of rate bytes per second. Zero means no limit.
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{rate: rate}
+}
+
+// SetRate sets the rate in bytes per second. Zero means no limit.
+func (l *Limiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rate != l.rate {
+		l.rate = rate
+		l.next = time.Time{}
+	}
+}
+
+// Rate returns the rate in bytes per second.
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// chunk returns the maximum number of bytes read at once so that a change of
+// rate applies quickly. It returns zero if there is no limit.
+func (l *Limiter) chunk() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	if c := l.rate / 10; c > 512 {
+		return int(c)
+	}
+	return 512
+}
+
+// wait blocks until n more bytes are allowed or ctx is done.
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	wait := l.next.Sub(now)
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	case <-t.C:
+		return nil
+	}
+}
+
+// limitReader reads from r no faster than l allows. ctx, when not nil,
+// cancels the waits.
+type limitReader struct {
+	io.ReadCloser
+	l   *Limiter
+	ctx context.Context
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	if c := r.l.chunk(); c > 0 && len(p) > c {
+		p = p[:c]
+	}
+	n, err := r.ReadCloser.Read(p)
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if werr := r.l.wait(ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
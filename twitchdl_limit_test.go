@@ -0,0 +1,42 @@
+package twitchdl
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(10000)
+	r := &limitReader{ReadCloser: ioutil.NopCloser(bytes.NewReader(make([]byte, 3000))), l: l}
+	started := time.Now()
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Len(t, b, 3000)
+	assert.True(t, time.Since(started) >= 250*time.Millisecond, time.Since(started))
+
+	l.SetRate(0)
+	assert.Equal(t, int64(0), l.Rate())
+	r = &limitReader{ReadCloser: ioutil.NopCloser(bytes.NewReader(make([]byte, 1<<20))), l: l}
+	started = time.Now()
+	_, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.True(t, time.Since(started) < 100*time.Millisecond, time.Since(started))
+}
+
+func TestLimiterCanceled(t *testing.T) {
+	l := NewLimiter(1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	r := &limitReader{ReadCloser: ioutil.NopCloser(bytes.NewReader(make([]byte, 3000))), l: l, ctx: ctx}
+	started := time.Now()
+	_, err := ioutil.ReadAll(r)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+	assert.True(t, time.Since(started) < time.Second, time.Since(started))
+}
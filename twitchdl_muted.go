@@ -0,0 +1,143 @@
+package twitchdl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/pkg/errors"
+)
+
+// unmutedURLs returns the URLs the original content of the muted segment at
+// segmentURL may still be available at: the "-unmuted.ts" URL and then the
+// unmarked ".ts" URL.
+func unmutedURLs(segmentURL string) []string {
+	u, query := segmentURL, ""
+	if i := strings.Index(segmentURL, "?"); i >= 0 {
+		u, query = segmentURL[:i], segmentURL[i:]
+	}
+	base := strings.TrimSuffix(u, "-muted.ts")
+	return []string{base + "-unmuted.ts" + query, base + ".ts" + query}
+}
+
+// unmuted returns the downloadFunc and sizeFunc of the muted segment at index
+// of the download trying its unmuted URLs first. download and size, the
+// funcs of the muted URL, are used only if every unmuted URL answers 403 or
+// 404. Other errors are returned so that the download is retried. Once a URL
+// answered, both funcs keep using it so that sizes match the content.
+// Segments whose original content is downloaded are added to recovered.
+func unmuted(ctx context.Context, client *http.Client, segment m3u8.MediaSegment, index, count int, download downloadFunc, size sizeFunc, events func(Event), recovered *unmutedSegments) (downloadFunc, sizeFunc, error) {
+	var downloads []downloadFunc
+	var sizes []sizeFunc
+	for _, u := range unmutedURLs(segment.URL) {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		req = req.WithContext(withSegment(ctx, segment.Number))
+		downloads = append(downloads, prepare(client, req))
+		sizes = append(sizes, prepareSize(client, req))
+	}
+	muted := len(downloads)
+	downloads = append(downloads, download)
+	sizes = append(sizes, size)
+
+	// chosen is the index of the URL serving the segment once known.
+	chosen := -1
+	try := func(fn func(i int) error) error {
+		if chosen >= 0 {
+			return fn(chosen)
+		}
+		for i := 0; i < muted; i++ {
+			err := fn(i)
+			if err == nil {
+				chosen = i
+				return nil
+			}
+			if !unavailable(err) {
+				return err
+			}
+		}
+		chosen = muted
+		return fn(chosen)
+	}
+	unmutedDownload := func() (io.ReadCloser, error) {
+		var body io.ReadCloser
+		err := try(func(i int) error {
+			var err error
+			body, err = downloads[i]()
+			return err
+		})
+		if err != nil || chosen == muted {
+			return body, err
+		}
+		recovered.add(segment.Number)
+		if events != nil {
+			events(Event{Type: EventUnmuted, Segment: index, Segments: count})
+		}
+		return body, nil
+	}
+	unmutedSize := func() (int64, error) {
+		var n int64
+		err := try(func(i int) error {
+			var err error
+			n, err = sizes[i]()
+			return err
+		})
+		return n, err
+	}
+	return unmutedDownload, unmutedSize, nil
+}
+
+// unavailable reports whether err is a request answered with 403 or 404.
+func unavailable(err error) bool {
+	se, ok := errors.Cause(err).(*statusError)
+	return ok && (se.code == http.StatusForbidden || se.code == http.StatusNotFound)
+}
+
+// unmutedSegments records the muted segments whose original content was
+// downloaded.
+type unmutedSegments struct {
+	mu      sync.Mutex
+	numbers map[int]bool
+}
+
+func (u *unmutedSegments) add(number int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.numbers == nil {
+		u.numbers = map[int]bool{}
+	}
+	u.numbers[number] = true
+}
+
+func (u *unmutedSegments) has(number int) bool {
+	if u == nil {
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.numbers[number]
+}
+
+// mutedRanges returns the ranges of the VOD of p covered by the muted
+// segments among segments, leaving out the unmuted ones. Consecutive muted
+// segments make a single range.
+func (p playlist) mutedRanges(segments []m3u8.MediaSegment, unmuted *unmutedSegments) []Range {
+	var ranges []Range
+	for _, segment := range segments {
+		if !segment.Muted || unmuted.has(segment.Number) {
+			continue
+		}
+		start := p.offset(segment.Number)
+		if n := len(ranges); n > 0 && ranges[n-1].End == start {
+			ranges[n-1].End += segment.Duration
+			continue
+		}
+		ranges = append(ranges, Range{Start: start, End: start + segment.Duration})
+	}
+	return ranges
+}
@@ -0,0 +1,78 @@
+package twitchdl
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmutedURLs(t *testing.T) {
+	assert.Equal(t, []string{"https://cdn.test/v/3-unmuted.ts?a=b", "https://cdn.test/v/3.ts?a=b"}, unmutedURLs("https://cdn.test/v/3-muted.ts?a=b"))
+}
+
+func TestDownloadMuted(t *testing.T) {
+	h := fakeTwitch(t, map[string]fakeVOD{"1": {segments: 6, muted: map[int]bool{1: true, 2: true, 4: true}}}, nil)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The original content of segment 2 is available unmarked only and
+		// the one of segment 4 is gone.
+		if strings.HasSuffix(r.URL.Path, "/2-unmuted.ts") || strings.HasPrefix(r.URL.Path, "/1/720p30/4") && !strings.HasSuffix(r.URL.Path, "-muted.ts") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h(w, r)
+	}))
+
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30"})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1-0;1-1-muted;1-2-muted;1-3;1-4-muted;1-5;", string(b))
+	assert.Equal(t, []Range{{10 * time.Second, 30 * time.Second}, {40 * time.Second, 50 * time.Second}}, stream.Info().Muted)
+
+	var unmuted []int
+	stream, err = DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Unmuted: true, Events: func(e Event) {
+		if e.Type == EventUnmuted {
+			unmuted = append(unmuted, e.Segment)
+		}
+	}})
+	require.NoError(t, err)
+	b, err = ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1-0;1-1-unmuted;1-2;1-3;1-4-muted;1-5;", string(b))
+	assert.Equal(t, []int{1, 2}, unmuted)
+	assert.Equal(t, []Range{{40 * time.Second, 50 * time.Second}}, stream.Info().Muted)
+}
+
+func TestDownloadUnmutedRetries(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	failures := 1
+	h := fakeTwitch(t, map[string]fakeVOD{"1": {segments: 3, muted: map[int]bool{1: true}}}, nil)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The unmuted URL fails once: the muted and unmarked URLs must not
+		// be used instead.
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/1-unmuted.ts") && failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		h(w, r)
+	}))
+
+	// The size of segment 0 and of the unmuted segment 1 are known from HEAD
+	// requests, resuming skips segment 0 and the start of segment 1.
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Unmuted: true, Retries: 1, Resume: 6})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1-unmuted;1-2;", string(b))
+	assert.Zero(t, failures)
+	assert.Empty(t, stream.Info().Muted)
+}
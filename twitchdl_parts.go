@@ -0,0 +1,169 @@
+package twitchdl
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Parts is a download split into parts at segment boundaries according to
+// Options.SplitDuration and Options.SplitSize.
+type Parts struct {
+	stream *Stream
+	// m is nil when the download cannot be split such as a clip.
+	m *merger
+	// offsets[i] is the position in the stream of the segment i.
+	offsets []time.Duration
+	split   Options
+	n       int
+	// part is the part returned by the last call to Next.
+	part *partReader
+}
+
+// DownloadParts sets up the download of the video "vURL" split into parts.
+// A part ends before the segment that would make it longer than
+// opts.SplitDuration or larger than opts.SplitSize, whichever comes first.
+// The size of the next segment is estimated from the average size of the
+// segments of the part. Clips are never split. Resume is ignored, see
+// Parts.Resume.
+func DownloadParts(ctx context.Context, client *http.Client, clientID, vURL string, opts Options) (*Parts, error) {
+	if opts.SplitDuration < 0 || opts.SplitSize < 0 {
+		return nil, errors.New("Negative split limits are not allowed")
+	}
+	opts.Resume = 0
+	stream, err := DownloadWithOptions(ctx, client, clientID, vURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	p := &Parts{stream: stream, split: opts}
+	m, ok := stream.ReadCloser.(*merger)
+	if !ok || (opts.SplitDuration == 0 && opts.SplitSize == 0) || len(stream.info.Segments) != len(m.downloads) {
+		return p, nil
+	}
+	p.m = m
+	p.offsets = make([]time.Duration, len(stream.info.Segments)+1)
+	for i, segment := range stream.info.Segments {
+		p.offsets[i+1] = p.offsets[i] + segment.Duration
+	}
+	return p, nil
+}
+
+// Next returns the next part or io.EOF once every part has been returned.
+// A part must be read until io.EOF before calling Next.
+func (p *Parts) Next() (*Stream, error) {
+	if p.m == nil {
+		if p.n > 0 {
+			return nil, io.EOF
+		}
+		p.n++
+		return p.stream, nil
+	}
+	if p.n > 0 && p.m.index >= len(p.m.downloads) {
+		return nil, io.EOF
+	}
+	p.n++
+	part := &partReader{m: p.m, start: p.m.index, end: -1}
+	p.part = part
+	p.m.paused = false
+	p.m.boundary = func(index int) bool {
+		if index == part.start {
+			return false
+		}
+		if d := p.split.SplitDuration; d > 0 && p.offsets[index+1]-p.offsets[part.start] > d {
+			return true
+		}
+		if limit := p.split.SplitSize; limit > 0 {
+			return part.n+part.n/int64(index-part.start) > limit
+		}
+		return false
+	}
+	return &Stream{ReadCloser: part, infoFn: func() Info {
+		end := part.end
+		if end < 0 || end > len(p.m.downloads) {
+			end = p.m.index
+		}
+		if end > len(p.m.downloads) {
+			end = len(p.m.downloads)
+		}
+		info := p.stream.Info()
+		info.Segments = info.Segments[part.start:end]
+		base := info.Start
+		info.Start = base + p.offsets[part.start]
+		info.End = base + p.offsets[end]
+		info.Ranges = nil
+		var muted []Range
+		for _, r := range info.Muted {
+			if r.Start < info.Start {
+				r.Start = info.Start
+			}
+			if r.End > info.End {
+				r.End = info.End
+			}
+			if r.Start < r.End {
+				muted = append(muted, r)
+			}
+		}
+		info.Muted = muted
+		var gaps []Gap
+		for _, g := range info.Gaps {
+			if g.Start >= info.Start && g.End <= info.End {
+				gaps = append(gaps, g)
+			}
+		}
+		info.Gaps = gaps
+		return info
+	}}, nil
+}
+
+// Resume skips the first n bytes of the part returned by the last call to
+// Next, typically the size of a partial download of the part. It must be
+// called before reading the part. Segments entirely skipped are not
+// downloaded when their size is known.
+func (p *Parts) Resume(n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	if p.m != nil {
+		p.m.skip = n
+		// Skipped bytes count toward the size of the part.
+		p.part.n = n
+		return nil
+	}
+	if m, ok := p.stream.ReadCloser.(*merger); ok {
+		m.skip = n
+		return nil
+	}
+	_, err := io.CopyN(ioutil.Discard, p.stream, n)
+	return errors.WithStack(err)
+}
+
+// Close closes the download.
+func (p *Parts) Close() error {
+	return p.stream.Close()
+}
+
+// partReader reads the segments of a part from a merger.
+type partReader struct {
+	m     *merger
+	start int
+	// end is the index of the segment following the part once read.
+	end int
+	n   int64
+}
+
+func (r *partReader) Read(b []byte) (int, error) {
+	n, err := r.m.Read(b)
+	r.n += int64(n)
+	if err == io.EOF && r.end < 0 {
+		r.end = r.m.index
+	}
+	return n, err
+}
+
+func (r *partReader) Close() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package twitchdl
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadParts(t *testing.T) {
+	var heads int
+	h := fakeTwitch(t, map[string]fakeVOD{"1": {segments: 5}}, nil)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads++
+		}
+		h(w, r)
+	}))
+
+	readParts := func(opts Options, resumes ...int64) ([]string, []Info) {
+		parts, err := DownloadParts(context.Background(), client, "", "https://www.twitch.tv/videos/1", opts)
+		require.NoError(t, err)
+		defer parts.Close()
+		var contents []string
+		var infos []Info
+		for {
+			part, err := parts.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			if len(contents) < len(resumes) {
+				require.NoError(t, parts.Resume(resumes[len(contents)]))
+			}
+			b, err := ioutil.ReadAll(part)
+			require.NoError(t, err)
+			contents = append(contents, string(b))
+			infos = append(infos, part.Info())
+		}
+		return contents, infos
+	}
+
+	contents, infos := readParts(Options{Quality: "720p30", SplitDuration: 20 * time.Second})
+	assert.Equal(t, []string{"1-0;1-1;", "1-2;1-3;", "1-4;"}, contents)
+	require.Len(t, infos, 3)
+	assert.Equal(t, 20*time.Second, infos[1].Start)
+	assert.Equal(t, 40*time.Second, infos[1].End)
+	assert.Len(t, infos[1].Segments, 2)
+	assert.Equal(t, 50*time.Second, infos[2].End)
+
+	// Segment bodies are 4 bytes long.
+	contents, _ = readParts(Options{Quality: "720p30", SplitSize: 12})
+	assert.Equal(t, []string{"1-0;1-1;1-2;", "1-3;1-4;"}, contents)
+	assert.Zero(t, heads)
+
+	// The first segment of the second part is skipped, the first part is
+	// resumed in the middle of its second segment.
+	contents, _ = readParts(Options{Quality: "720p30", SplitSize: 12}, 6, 4)
+	assert.Equal(t, []string{"1;1-2;", "1-4;"}, contents)
+
+	contents, infos = readParts(Options{Quality: "720p30", Start: 10 * time.Second, SplitSize: 9, SplitDuration: 30 * time.Second})
+	assert.Equal(t, []string{"1-1;1-2;", "1-3;1-4;"}, contents)
+	assert.Equal(t, 30*time.Second, infos[1].Start)
+
+	contents, _ = readParts(Options{Quality: "720p30"})
+	assert.Equal(t, []string{"1-0;1-1;1-2;1-3;1-4;"}, contents)
+}
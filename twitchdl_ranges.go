@@ -0,0 +1,189 @@
+package twitchdl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// Range is the [Start, End) range of a VOD. Negative values are relative to
+// the end of the VOD and a zero End means the end of the VOD.
+type Range struct {
+	Start, End time.Duration
+}
+
+// DownloadRanges sets up the download of each range of opts.Ranges of the
+// VOD "vURL" as its own Stream. The media playlist is fetched once and the
+// segments shared by several ranges are downloaded once. Start, End and
+// Duration of opts are ignored and Resume is replaced by RangeResumes. vURL
+// can also be an HLS playlist, see IsPlaylist.
+func DownloadRanges(ctx context.Context, client *http.Client, clientID, vURL string, opts Options) ([]*Stream, error) {
+	if len(opts.Ranges) == 0 {
+		return nil, errors.New("no range specified")
+	}
+	var p playlist
+	if IsPlaylist(vURL) {
+		client = fileClient(client, vURL)
+		var err error
+		if p, err = fetchHLS(ctx, client, vURL, opts.Quality); err != nil {
+			return nil, err
+		}
+	} else {
+		id, vType, err := twitch.ID(vURL)
+		if err != nil {
+			return nil, err
+		}
+		if vType != twitch.TypeVOD {
+			return nil, errors.Errorf("ranges are only supported for VODs: %s", vURL)
+		}
+		if p, err = fetchPlaylist(ctx, client, clientID, id, opts.Quality); err != nil {
+			return nil, err
+		}
+	}
+	slices, _, err := p.slices(opts.Ranges)
+	if err != nil {
+		return nil, err
+	}
+	cache := newSegmentCache(slices)
+	var streams []*Stream
+	for i, segments := range slices {
+		opts.Resume = 0
+		if i < len(opts.RangeResumes) {
+			opts.Resume = opts.RangeResumes[i]
+		}
+		stream, err := p.stream(ctx, client, segments, opts, cache)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// slices returns the segments of each range and the resolved ranges.
+func (p playlist) slices(ranges []Range) ([][]m3u8.MediaSegment, []Range, error) {
+	length := p.length()
+	var slices [][]m3u8.MediaSegment
+	var resolved []Range
+	for _, r := range ranges {
+		start, end, err := ResolveRange(length, r.Start, r.End, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		segments, err := sliceSegments(p.media.Segments, start, end)
+		if err != nil {
+			return nil, nil, err
+		}
+		if end == 0 {
+			end = length
+		}
+		slices = append(slices, segments)
+		resolved = append(resolved, Range{Start: start, End: end})
+	}
+	return slices, resolved, nil
+}
+
+// concat returns the Stream of the segments of every range of opts.Ranges
+// in order. Segments shared by several ranges are included once.
+func (p playlist) concat(ctx context.Context, client *http.Client, opts Options) (*Stream, error) {
+	slices, ranges, err := p.slices(opts.Ranges)
+	if err != nil {
+		return nil, err
+	}
+	var segments []m3u8.MediaSegment
+	seen := map[int]bool{}
+	for _, slice := range slices {
+		for _, segment := range slice {
+			if seen[segment.Number] {
+				continue
+			}
+			seen[segment.Number] = true
+			segments = append(segments, segment)
+		}
+	}
+	stream, err := p.stream(ctx, client, segments, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	stream.info.Ranges = ranges
+	return stream, nil
+}
+
+// segmentCache keeps the content of the segments shared by several streams
+// until every stream has read them.
+type segmentCache struct {
+	entries map[int]*cacheEntry
+}
+
+type cacheEntry struct {
+	mu   sync.Mutex
+	refs int
+	data []byte
+}
+
+func newSegmentCache(slices [][]m3u8.MediaSegment) *segmentCache {
+	refs := map[int]int{}
+	for _, slice := range slices {
+		for _, segment := range slice {
+			refs[segment.Number]++
+		}
+	}
+	c := &segmentCache{entries: map[int]*cacheEntry{}}
+	for number, n := range refs {
+		if n > 1 {
+			c.entries[number] = &cacheEntry{refs: n}
+		}
+	}
+	return c
+}
+
+// release drops the reference to the segment "number" of a stream skipping
+// it.
+func (c *segmentCache) release(number int) {
+	e, ok := c.entries[number]
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.refs--; e.refs == 0 {
+		e.data = nil
+	}
+}
+
+// wrap returns the downloadFunc of the segment "number" going through the
+// cache if the segment is shared.
+func (c *segmentCache) wrap(number int, download downloadFunc) downloadFunc {
+	e, ok := c.entries[number]
+	if !ok {
+		return download
+	}
+	return func() (io.ReadCloser, error) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.data == nil {
+			body, err := download()
+			if err != nil {
+				return nil, err
+			}
+			defer body.Close()
+			if e.data, err = ioutil.ReadAll(body); err != nil {
+				e.data = nil
+				return nil, errors.WithStack(err)
+			}
+		}
+		data := e.data
+		if e.refs--; e.refs == 0 {
+			e.data = nil
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+}
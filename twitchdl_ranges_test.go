@@ -0,0 +1,86 @@
+package twitchdl
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadRanges(t *testing.T) {
+	var playlists int
+	gets := map[string]int{}
+	h := fakeTwitch(t, map[string]fakeVOD{"1": {segments: 6}}, nil)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".m3u8"):
+			playlists++
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, ".ts"):
+			gets[path.Base(r.URL.Path)]++
+		}
+		h(w, r)
+	}))
+
+	ranges := []Range{{Start: 0, End: 20 * time.Second}, {Start: 10 * time.Second, End: 30 * time.Second}, {Start: -10 * time.Second}}
+	streams, err := DownloadRanges(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Ranges: ranges})
+	require.NoError(t, err)
+	require.Len(t, streams, 3)
+	var actual []string
+	for _, stream := range streams {
+		b, err := ioutil.ReadAll(stream)
+		require.NoError(t, err)
+		actual = append(actual, string(b))
+	}
+	assert.Equal(t, []string{"1-0;1-1;", "1-1;1-2;", "1-5;"}, actual)
+	assert.Equal(t, 1, playlists)
+	assert.Equal(t, map[string]int{"0.ts": 1, "1.ts": 1, "2.ts": 1, "5.ts": 1}, gets)
+	assert.Equal(t, 10*time.Second, streams[1].Info().Start)
+	assert.Equal(t, 30*time.Second, streams[1].Info().End)
+
+	// The second range resumes after its first segment, the third in the
+	// middle of its segment.
+	gets = map[string]int{}
+	streams, err = DownloadRanges(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Ranges: ranges, RangeResumes: []int64{0, 4, 2}})
+	require.NoError(t, err)
+	actual = nil
+	for _, stream := range streams {
+		b, err := ioutil.ReadAll(stream)
+		require.NoError(t, err)
+		actual = append(actual, string(b))
+	}
+	assert.Equal(t, []string{"1-0;1-1;", "1-2;", "5;"}, actual)
+	assert.Equal(t, map[string]int{"0.ts": 1, "1.ts": 1, "2.ts": 1, "5.ts": 1}, gets)
+
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Ranges: ranges})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1-0;1-1;1-2;1-5;", string(b))
+	assert.Equal(t, []Range{{0, 20 * time.Second}, {10 * time.Second, 30 * time.Second}, {50 * time.Second, time.Minute}}, stream.Info().Ranges)
+
+	_, err = DownloadRanges(context.Background(), client, "", "https://clips.twitch.tv/Slug", Options{Ranges: ranges})
+	assert.Error(t, err)
+}
+
+func TestSegmentCacheRelease(t *testing.T) {
+	segment := m3u8.MediaSegment{Number: 1}
+	cache := newSegmentCache([][]m3u8.MediaSegment{{segment}, {segment}})
+	download := cache.wrap(1, func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader("1")), nil })
+
+	// The first stream skips the segment, the second one reads it.
+	cache.release(1)
+	body, err := download()
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(b))
+	assert.Nil(t, cache.entries[1].data)
+}
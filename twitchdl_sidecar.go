@@ -0,0 +1,145 @@
+package twitchdl
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/pkg/errors"
+)
+
+// Sidecar is the content of the .info.json file written next to a download.
+type Sidecar struct {
+	Metadata Metadata `json:"metadata"`
+	// Download is nil when the content of the download is unknown.
+	Download *Info `json:"download,omitempty"`
+	// MutedSegments are the muted ranges of the VOD in seconds.
+	MutedSegments []twitch.MutedSegment `json:"muted_segments,omitempty"`
+	Version       string                `json:"version"`
+	StartedAt     time.Time             `json:"started_at"`
+	FinishedAt    time.Time             `json:"finished_at"`
+}
+
+// NewSidecar returns the Sidecar of a download of the video described by m
+// whose content is described by info.
+func NewSidecar(m Metadata, info *Info, version string, startedAt, finishedAt time.Time) Sidecar {
+	s := Sidecar{
+		Metadata:   m,
+		Download:   info,
+		Version:    version,
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+	}
+	if m.VOD != nil {
+		s.MutedSegments = m.VOD.MutedSegments
+	}
+	return s
+}
+
+// WriteInfoJSON writes s as indented JSON.
+func WriteInfoJSON(w io.Writer, s Sidecar) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(s))
+}
+
+// nfo is a Kodi movie .nfo file, also understood by Jellyfin and Plex agents.
+//
+// https://kodi.wiki/view/NFO_files/Movies
+type nfo struct {
+	XMLName   xml.Name `xml:"movie"`
+	Title     string   `xml:"title"`
+	Plot      string   `xml:"plot,omitempty"`
+	Runtime   int      `xml:"runtime,omitempty"`
+	Premiered string   `xml:"premiered,omitempty"`
+	Year      int      `xml:"year,omitempty"`
+	Studio    string   `xml:"studio,omitempty"`
+	Genre     string   `xml:"genre,omitempty"`
+	Tags      []string `xml:"tag,omitempty"`
+	Thumb     string   `xml:"thumb,omitempty"`
+	UniqueID  struct {
+		Type    string `xml:"type,attr"`
+		Default bool   `xml:"default,attr"`
+		ID      string `xml:",chardata"`
+	} `xml:"uniqueid"`
+}
+
+// WriteNFO writes the metadata m as a Kodi style .nfo file.
+func WriteNFO(w io.Writer, m Metadata) error {
+	f := m.Fields()
+	n := nfo{
+		Title:   f.Title,
+		Runtime: int(f.End.Round(time.Minute) / time.Minute),
+		Studio:  f.Channel,
+		Genre:   f.Game,
+		Thumb:   thumbnailURL(m),
+	}
+	if !f.Date.IsZero() {
+		n.Premiered = f.Date.Format("2006-01-02")
+		n.Year = f.Date.Year()
+	}
+	switch {
+	case m.VOD != nil:
+		n.Plot = m.VOD.Description
+		n.Tags = m.VOD.Tags
+	case m.Collection != nil:
+		n.Plot = m.Collection.Description
+	}
+	n.UniqueID.Type = "twitch"
+	n.UniqueID.Default = true
+	n.UniqueID.ID = f.ID
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.WithStack(err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(n); err != nil {
+		return errors.WithStack(err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return errors.WithStack(err)
+}
+
+func thumbnailURL(m Metadata) string {
+	switch {
+	case m.VOD != nil:
+		return m.VOD.ThumbnailURL
+	case m.Clip != nil:
+		return m.Clip.ThumbnailURL
+	case m.Collection != nil && len(m.Collection.VODs) > 0:
+		return m.Collection.VODs[0].ThumbnailURL
+	}
+	return ""
+}
+
+// Thumbnail downloads the thumbnail of the video described by m.
+// ext is the extension of the thumbnail such as ".jpg".
+func Thumbnail(ctx context.Context, client *http.Client, m Metadata) (_ io.ReadCloser, ext string, _ error) {
+	u := thumbnailURL(m)
+	if len(u) == 0 {
+		return nil, "", errors.New("no thumbnail available")
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", errors.WithStack(twitch.RedactError(err))
+	}
+	if s := resp.StatusCode; s < 200 || s >= 300 {
+		resp.Body.Close()
+		return nil, "", errors.Errorf("%d: %s", s, twitch.RedactURL(req.URL.String()))
+	}
+	ext = path.Ext(req.URL.Path)
+	if len(ext) == 0 {
+		ext = ".jpg"
+	}
+	return resp.Body, ext, nil
+}
@@ -0,0 +1,92 @@
+package twitchdl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/jybp/twitch-downloader/twitch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamInfo(t *testing.T) {
+	client := testClient(t, fakeTwitch(t, map[string]fakeVOD{"12345": {segments: 6}}, nil))
+	stream, err := DownloadWithOptions(context.Background(), client, "clientID", "12345", Options{
+		Quality: "720p30",
+		Start:   15 * time.Second,
+		End:     35 * time.Second,
+	})
+	require.NoError(t, err)
+	info := stream.Info()
+	assert.Equal(t, "720p30", info.Quality)
+	require.NotNil(t, info.Variant)
+	assert.Equal(t, "https://cdn.test/12345/720p30/index-dvr.m3u8", info.Variant.URL)
+	require.Len(t, info.Segments, 3)
+	assert.Equal(t, 1, info.Segments[0].Number)
+	assert.Equal(t, 10*time.Second, info.Start)
+	assert.Equal(t, 40*time.Second, info.End)
+}
+
+func TestWriteInfoJSON(t *testing.T) {
+	vod := twitch.VOD{ID: "12345", Title: "Title", MutedSegments: []twitch.MutedSegment{{Offset: 10, Duration: 20}}}
+	info := Info{
+		Quality:  "720p30",
+		Segments: []m3u8.MediaSegment{{Number: 1}, {Number: 2}},
+		Start:    10 * time.Second,
+		End:      30 * time.Second,
+	}
+	started := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	sidecar := NewSidecar(Metadata{Type: twitch.TypeVOD, VOD: &vod}, &info, "v1.0.0", started, started.Add(time.Minute))
+
+	var b bytes.Buffer
+	require.NoError(t, WriteInfoJSON(&b, sidecar))
+	var actual map[string]interface{}
+	require.NoError(t, json.Unmarshal(b.Bytes(), &actual))
+	assert.Equal(t, "v1.0.0", actual["version"])
+	assert.Equal(t, "2021-03-04T05:06:07Z", actual["started_at"])
+	assert.Equal(t, "2021-03-04T05:07:07Z", actual["finished_at"])
+	assert.Equal(t, "12345", actual["metadata"].(map[string]interface{})["vod"].(map[string]interface{})["id"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"offset": 10.0, "duration": 20.0}}, actual["muted_segments"])
+	assert.Equal(t, map[string]interface{}{
+		"quality":       "720p30",
+		"first_segment": 1.0,
+		"last_segment":  2.0,
+		"segment_count": 2.0,
+		"start":         10.0,
+		"end":           30.0,
+	}, actual["download"])
+}
+
+func TestWriteNFO(t *testing.T) {
+	vod := twitch.VOD{
+		ID:            "12345",
+		Title:         "Title & more",
+		Description:   "Desc",
+		LengthSeconds: 3600,
+		CreatedAt:     time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		ThumbnailURL:  "https://example.com/thumb.jpg",
+		Owner:         twitch.User{DisplayName: "Owner"},
+		Game:          twitch.Game{Name: "Game"},
+		Tags:          []string{"English"},
+	}
+	var b bytes.Buffer
+	require.NoError(t, WriteNFO(&b, Metadata{Type: twitch.TypeVOD, VOD: &vod}))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<movie>
+  <title>Title &amp; more</title>
+  <plot>Desc</plot>
+  <runtime>60</runtime>
+  <premiered>2021-03-04</premiered>
+  <year>2021</year>
+  <studio>Owner</studio>
+  <genre>Game</genre>
+  <tag>English</tag>
+  <thumb>https://example.com/thumb.jpg</thumb>
+  <uniqueid type="twitch" default="true">12345</uniqueid>
+</movie>
+`, b.String())
+}
@@ -1,11 +1,20 @@
 package twitchdl
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -91,3 +100,301 @@ func TestSliceSegments(t *testing.T) {
 		})
 	}
 }
+
+// handlerTransport serves every request with a handler, without network.
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.h.ServeHTTP(w, req)
+	resp := w.Result()
+	if resp.ContentLength < 0 {
+		resp.ContentLength = int64(w.Body.Len())
+	}
+	if req.Method == http.MethodHead {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// testClient returns an http.Client whose requests are all handled by h.
+func testClient(t *testing.T, h http.Handler) *http.Client {
+	return &http.Client{Transport: handlerTransport{h: h}}
+}
+
+// gqlHandler answers GQL queries with the response matching the first
+// key of responses contained in the request body.
+func gqlHandler(t *testing.T, responses map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		for k, v := range responses {
+			if strings.Contains(string(b), k) {
+				w.Write([]byte(v))
+				return
+			}
+		}
+		t.Errorf("unexpected request %s %s", r.URL, b)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestClipContext(t *testing.T) {
+	tcs := []struct {
+		name          string
+		responses     map[string]string
+		padding       time.Duration
+		expectedURL   string
+		expectedStart time.Duration
+		expectedEnd   time.Duration
+		unavailable   bool
+	}{
+		{
+			name: "padded",
+			responses: map[string]string{
+				"query Clip": `{"data":{"clip":{"durationSeconds":30,"video":{"id":"12345"},"videoOffsetSeconds":600}}}`,
+				"query VOD":  `{"data":{"video":{"id":"12345","lengthSeconds":3600}}}`,
+			},
+			padding:       2 * time.Minute,
+			expectedURL:   "https://www.twitch.tv/videos/12345",
+			expectedStart: 8 * time.Minute,
+			expectedEnd:   12*time.Minute + 30*time.Second,
+		},
+		{
+			name: "clamped",
+			responses: map[string]string{
+				"query Clip": `{"data":{"clip":{"durationSeconds":30,"video":{"id":"12345"},"videoOffsetSeconds":60}}}`,
+				"query VOD":  `{"data":{"video":{"id":"12345","lengthSeconds":3600}}}`,
+			},
+			padding:       2 * time.Minute,
+			expectedURL:   "https://www.twitch.tv/videos/12345",
+			expectedStart: 0,
+			expectedEnd:   3*time.Minute + 30*time.Second,
+		},
+		{
+			name: "clamped to the VOD",
+			responses: map[string]string{
+				"query Clip": `{"data":{"clip":{"durationSeconds":30,"video":{"id":"12345"},"videoOffsetSeconds":3550}}}`,
+				"query VOD":  `{"data":{"video":{"id":"12345","lengthSeconds":3600}}}`,
+			},
+			padding:       2 * time.Minute,
+			expectedURL:   "https://www.twitch.tv/videos/12345",
+			expectedStart: 3430 * time.Second,
+			expectedEnd:   time.Hour,
+		},
+		{
+			name: "no video",
+			responses: map[string]string{
+				"query Clip": `{"data":{"clip":{"durationSeconds":30,"video":null,"videoOffsetSeconds":0}}}`,
+			},
+			padding:     time.Minute,
+			unavailable: true,
+		},
+		{
+			name: "expired video",
+			responses: map[string]string{
+				"query Clip": `{"data":{"clip":{"durationSeconds":30,"video":{"id":"12345"},"videoOffsetSeconds":60}}}`,
+				"query VOD":  `{"data":{"video":null}}`,
+			},
+			padding:     time.Minute,
+			unavailable: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			client := testClient(t, gqlHandler(t, tc.responses))
+			vodURL, start, end, err := ClipContext(context.Background(), client, "clientID", "https://clips.twitch.tv/Slug123", tc.padding)
+			if tc.unavailable {
+				require.Error(t, err)
+				assert.Equal(t, ErrSourceVODUnavailable, errors.Cause(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedURL, vodURL)
+			assert.Equal(t, tc.expectedStart, start)
+			assert.Equal(t, tc.expectedEnd, end)
+		})
+	}
+}
+
+// fakeVOD describes a VOD served by fakeTwitch.
+type fakeVOD struct {
+	title    string
+	segments int
+	// muted segments are listed with "-muted.ts" URLs.
+	muted map[int]bool
+}
+
+// fakeTwitch serves the twitch API, usher and CDN for vods.
+// Each segment lasts 10 seconds and its content is "<vod id>-<segment number>;".
+func fakeTwitch(t *testing.T, vods map[string]fakeVOD, gql map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		elems := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case r.URL.Path == "/gql":
+			b, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			if strings.Contains(string(b), "PlaybackAccessToken") {
+				w.Write([]byte(`{"data":{"videoPlaybackAccessToken":{"value":"token","signature":"sig"}}}`))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+			gqlHandler(t, gql)(w, r)
+		case len(elems) == 2 && elems[0] == "vod":
+			if _, ok := vods[elems[1]]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, "#EXTM3U\n"+
+				"#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID=\"chunked\",NAME=\"1080p60\",AUTOSELECT=YES,DEFAULT=YES\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,VIDEO=\"chunked\"\n"+
+				"https://cdn.test/%[1]s/chunked/index-dvr.m3u8\n"+
+				"#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID=\"720p30\",NAME=\"720p30\",AUTOSELECT=YES,DEFAULT=NO\n"+
+				"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720,VIDEO=\"720p30\"\n"+
+				"https://cdn.test/%[1]s/720p30/index-dvr.m3u8\n", elems[1])
+		case len(elems) == 3 && elems[2] == "index-dvr.m3u8":
+			vod, ok := vods[elems[0]]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:0\n")
+			for i := 0; i < vod.segments; i++ {
+				if vod.muted[i] {
+					fmt.Fprintf(w, "#EXTINF:10.000,\n%d-muted.ts\n", i)
+					continue
+				}
+				fmt.Fprintf(w, "#EXTINF:10.000,\n%d.ts\n", i)
+			}
+			fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+		case len(elems) == 3 && strings.HasSuffix(elems[2], ".ts"):
+			fmt.Fprintf(w, "%s-%s;", elems[0], strings.TrimSuffix(elems[2], ".ts"))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestMergerRetries(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	failures := 2
+	var events []Event
+	m := &merger{
+		downloads: []downloadFunc{
+			func() (io.ReadCloser, error) { return ioutil.NopCloser(strings.NewReader("a")), nil },
+			func() (io.ReadCloser, error) {
+				if failures > 0 {
+					failures--
+					return nil, errors.New("503")
+				}
+				return ioutil.NopCloser(strings.NewReader("bc")), nil
+			},
+		},
+		retries: 2,
+		events:  func(e Event) { events = append(events, e) },
+	}
+	b, err := ioutil.ReadAll(m)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(b))
+	require.Len(t, events, 4)
+	assert.Equal(t, Event{Type: EventSegment, Segment: 0, Segments: 2, Bytes: 1}, events[0])
+	assert.Equal(t, EventRetry, events[1].Type)
+	assert.Equal(t, 1, events[1].Attempt)
+	assert.Equal(t, 2, events[2].Attempt)
+	assert.Equal(t, Event{Type: EventSegment, Segment: 1, Segments: 2, Bytes: 2}, events[3])
+
+	failures = 3
+	m = &merger{downloads: m.downloads[1:], retries: 2}
+	_, err = ioutil.ReadAll(m)
+	assert.Error(t, err)
+}
+
+// failingBody fails its first read.
+type failingBody struct{}
+
+func (failingBody) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+func (failingBody) Close() error             { return nil }
+
+func TestMergerBodyRetries(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = 0
+
+	failures := 2
+	download := func() (io.ReadCloser, error) {
+		if failures > 0 {
+			failures--
+			return failingBody{}, nil
+		}
+		return ioutil.NopCloser(strings.NewReader("bc")), nil
+	}
+	var events []Event
+	m := &merger{downloads: []downloadFunc{download}, retries: 2, events: func(e Event) { events = append(events, e) }}
+	b, err := ioutil.ReadAll(m)
+	require.NoError(t, err)
+	assert.Equal(t, "bc", string(b))
+	require.Len(t, events, 3)
+	assert.Equal(t, EventRetry, events[0].Type)
+	assert.Equal(t, 2, events[1].Attempt)
+
+	failures = 3
+	m = &merger{downloads: []downloadFunc{download}, retries: 1}
+	_, err = ioutil.ReadAll(m)
+	assert.EqualError(t, err, "connection reset")
+
+	failures = 3
+	m = &merger{downloads: []downloadFunc{download}, retries: 1, fill: func(index int, err error) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("filled")), nil
+	}}
+	b, err = ioutil.ReadAll(m)
+	require.NoError(t, err)
+	assert.Equal(t, "filled", string(b))
+}
+
+func TestMergerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &merger{
+		ctx:       ctx,
+		downloads: []downloadFunc{func() (io.ReadCloser, error) { return nil, errors.New("503") }},
+		retries:   1,
+		delay:     time.Hour,
+		events:    func(Event) { cancel() },
+	}
+	_, err := ioutil.ReadAll(m)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+func TestResume(t *testing.T) {
+	var gets []string
+	h := fakeTwitch(t, map[string]fakeVOD{"1": {segments: 3}}, nil)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, ".ts") {
+			gets = append(gets, path.Base(r.URL.Path))
+		}
+		h(w, r)
+	}))
+
+	for _, tc := range []struct {
+		resume   int64
+		expected string
+		gets     []string
+	}{
+		{resume: 0, expected: "1-0;1-1;1-2;", gets: []string{"0.ts", "1.ts", "2.ts"}},
+		{resume: 4, expected: "1-1;1-2;", gets: []string{"1.ts", "2.ts"}},
+		{resume: 6, expected: "1;1-2;", gets: []string{"1.ts", "2.ts"}},
+		{resume: 12, expected: "", gets: nil},
+	} {
+		gets = nil
+		stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Resume: tc.resume})
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(stream)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, string(b), "resume %d", tc.resume)
+		assert.Equal(t, tc.gets, gets, "resume %d", tc.resume)
+	}
+}
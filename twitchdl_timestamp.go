@@ -0,0 +1,112 @@
+package twitchdl
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParseTimestamp parses a position in a video such as "1:23:45", "83:45",
+// "5025", "1h23m45s" or the "?t=1h23m45s" of a share link. Fractional
+// seconds are allowed. A leading "-" returns a negative timestamp meaning
+// a position before the end of the video, see ResolveRange.
+func ParseTimestamp(s string) (time.Duration, error) {
+	t := strings.TrimSpace(s)
+	for _, prefix := range []string{"?t=", "&t=", "t="} {
+		t = strings.TrimPrefix(t, prefix)
+	}
+	sign := time.Duration(1)
+	if strings.HasPrefix(t, "-") {
+		sign, t = -1, t[1:]
+	}
+	if len(t) == 0 || strings.HasPrefix(t, "-") || strings.HasPrefix(t, "+") {
+		return 0, errors.Errorf("invalid timestamp %q", s)
+	}
+
+	if !strings.Contains(t, ":") {
+		if seconds, ok := parseSeconds(t); ok {
+			return sign * seconds, nil
+		}
+		if !secondsRe.MatchString(t) {
+			d, err := time.ParseDuration(t)
+			if err == nil {
+				return sign * d, nil
+			}
+		}
+		return 0, errors.Errorf("invalid timestamp %q", s)
+	}
+
+	parts := strings.Split(t, ":")
+	if len(parts) > 3 {
+		return 0, errors.Errorf("invalid timestamp %q", s)
+	}
+	d, ok := parseSeconds(parts[len(parts)-1])
+	if !ok || d >= time.Minute {
+		return 0, errors.Errorf("invalid timestamp %q", s)
+	}
+	unit := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		// Only the leading part may overflow such as the minutes of "83:45".
+		if err != nil || n < 0 || (i > 0 && n >= 60) || int64(n) > int64(maxTimestamp/unit) {
+			return 0, errors.Errorf("invalid timestamp %q", s)
+		}
+		d += time.Duration(n) * unit
+		unit *= 60
+	}
+	if d > maxTimestamp {
+		return 0, errors.Errorf("invalid timestamp %q", s)
+	}
+	return sign * d, nil
+}
+
+// maxTimestamp bounds timestamps well below the overflow of time.Duration.
+const maxTimestamp = 1000000 * time.Hour
+
+// secondsRe matches a number of seconds such as "5025" or "12.5".
+var secondsRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// parseSeconds parses a number of seconds matching secondsRe. Unlike
+// strconv.ParseFloat, it rejects signs, exponents, NaN and infinities.
+func parseSeconds(s string) (time.Duration, bool) {
+	if !secondsRe.MatchString(s) {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds > maxTimestamp.Seconds() {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// ResolveRange resolves start and end against the length of a video.
+// Negative timestamps are relative to the end of the video. A positive
+// duration sets end to start plus duration and cannot be used along with
+// end. A zero end means the end of the video and is returned as is.
+func ResolveRange(length, start, end, duration time.Duration) (time.Duration, time.Duration, error) {
+	if start < 0 {
+		start += length
+		if start < 0 {
+			return 0, 0, errors.Errorf("Start timestamp is before the beginning of the video (video duration is %v)", length)
+		}
+	}
+	if end < 0 {
+		end += length
+		if end <= 0 {
+			return 0, 0, errors.Errorf("End timestamp is before the beginning of the video (video duration is %v)", length)
+		}
+	}
+	if duration < 0 {
+		return 0, 0, errors.New("Negative durations are not allowed")
+	}
+	if duration > 0 {
+		if end != 0 {
+			return 0, 0, errors.New("End timestamp and duration cannot be used together")
+		}
+		end = start + duration
+	}
+	return start, end, nil
+}
@@ -0,0 +1,102 @@
+package twitchdl
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tcs := []struct {
+		input    string
+		expected time.Duration
+		err      bool
+	}{
+		{input: "1:23:45", expected: time.Hour + 23*time.Minute + 45*time.Second},
+		{input: "83:45", expected: 83*time.Minute + 45*time.Second},
+		{input: "0:05", expected: 5 * time.Second},
+		{input: "5025", expected: 5025 * time.Second},
+		{input: "12.5", expected: 12500 * time.Millisecond},
+		{input: "1:02:03.25", expected: time.Hour + 2*time.Minute + 3250*time.Millisecond},
+		{input: "1h23m45s", expected: time.Hour + 23*time.Minute + 45*time.Second},
+		{input: "?t=1h2m3s", expected: time.Hour + 2*time.Minute + 3*time.Second},
+		{input: "t=90s", expected: 90 * time.Second},
+		{input: "-10m", expected: -10 * time.Minute},
+		{input: "-1:30", expected: -90 * time.Second},
+		{input: " 45 ", expected: 45 * time.Second},
+		{input: "", err: true},
+		{input: "-", err: true},
+		{input: "--5", err: true},
+		{input: "1:60", err: true},
+		{input: "1:61:00", err: true},
+		{input: "1:2:3:4", err: true},
+		{input: "a:00", err: true},
+		{input: "soon", err: true},
+		{input: "NaN", err: true},
+		{input: "inf", err: true},
+		{input: "-Inf", err: true},
+		{input: "1e3", err: true},
+		{input: "0x10", err: true},
+		{input: "1:NaN", err: true},
+		{input: "1:1e1", err: true},
+		{input: "1:+5", err: true},
+		{input: "99999999999999999999", err: true},
+		{input: "9999999999:00:00", err: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			actual, err := ParseTimestamp(tc.input)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestResolveRange(t *testing.T) {
+	length := time.Hour
+	tcs := []struct {
+		start, end, duration       time.Duration
+		expectedStart, expectedEnd time.Duration
+		err                        bool
+	}{
+		{},
+		{start: time.Minute, end: 2 * time.Minute, expectedStart: time.Minute, expectedEnd: 2 * time.Minute},
+		{end: -10 * time.Minute, expectedEnd: 50 * time.Minute},
+		{start: -10 * time.Minute, expectedStart: 50 * time.Minute},
+		{start: time.Minute, duration: 30 * time.Minute, expectedStart: time.Minute, expectedEnd: 31 * time.Minute},
+		{start: -30 * time.Minute, duration: 10 * time.Minute, expectedStart: 30 * time.Minute, expectedEnd: 40 * time.Minute},
+		{start: -2 * time.Hour, err: true},
+		{end: -time.Hour, err: true},
+		{end: time.Minute, duration: time.Minute, err: true},
+		{duration: -time.Minute, err: true},
+	}
+	for _, tc := range tcs {
+		start, end, err := ResolveRange(length, tc.start, tc.end, tc.duration)
+		if tc.err {
+			assert.Error(t, err, "%+v", tc)
+			continue
+		}
+		require.NoError(t, err, "%+v", tc)
+		assert.Equal(t, tc.expectedStart, start, "%+v", tc)
+		assert.Equal(t, tc.expectedEnd, end, "%+v", tc)
+	}
+}
+
+func TestDownloadRelativeRange(t *testing.T) {
+	client := testClient(t, fakeTwitch(t, map[string]fakeVOD{"1": {segments: 6}}, nil))
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Start: -30 * time.Second, Duration: 20 * time.Second})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1-3;1-4;", string(b))
+	assert.Equal(t, 30*time.Second, stream.Info().Start)
+	assert.Equal(t, 50*time.Second, stream.Info().End)
+}
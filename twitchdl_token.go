@@ -0,0 +1,190 @@
+package twitchdl
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// refreshMargin is how long before the expiry of the playback token the
+// playlists are fetched again.
+var refreshMargin = 5 * time.Minute
+
+// minRefreshInterval limits the refreshes caused by rejected segments.
+const minRefreshInterval = time.Minute
+
+// refresher is the http.RoundTripper resolving the segments of a playlist
+// against the latest playlists. The playlists are fetched again shortly
+// before the playback token expires or when a segment is forbidden, and
+// segments are matched by sequence number, carried by the context of their
+// requests, see withSegment.
+type refresher struct {
+	rt    http.RoundTripper
+	fetch func(ctx context.Context) (playlist, error)
+	// origins maps the number of the segments to their original URL.
+	origins map[int]origin
+
+	mu        sync.Mutex
+	expires   time.Time
+	refreshed time.Time
+	// urls maps the number of the segments to their latest URL.
+	urls map[int]*url.URL
+	// flight, when not nil, is the ongoing refresh.
+	flight *flight
+}
+
+type origin struct {
+	path string
+	host string
+}
+
+// flight is a refresh of the playlists shared by the requests waiting for
+// it. err is set before done is closed.
+type flight struct {
+	done chan struct{}
+	err  error
+}
+
+func newRefresher(p playlist, rt http.RoundTripper) (*refresher, error) {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	r := &refresher{rt: rt, fetch: p.refresh, expires: p.expires, origins: map[int]origin{}, urls: map[int]*url.URL{}}
+	for _, segment := range p.media.Segments {
+		u, err := url.Parse(segment.URL)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		r.origins[segment.Number] = origin{path: u.Path, host: u.Host}
+		r.urls[segment.Number] = u
+	}
+	return r, nil
+}
+
+type segmentKey struct{}
+
+// withSegment returns ctx for the requests of the segment "number", whatever
+// their URL: the muted, unmuted or another variant's URL of the segment.
+func withSegment(ctx context.Context, number int) context.Context {
+	return context.WithValue(ctx, segmentKey{}, number)
+}
+
+// client returns client whose segment requests go through r.
+func (r *refresher) client(client *http.Client) *http.Client {
+	c := *client
+	c.Transport = r
+	return &c
+}
+
+func (r *refresher) RoundTrip(req *http.Request) (*http.Response, error) {
+	number, ok := req.Context().Value(segmentKey{}).(int)
+	if !ok {
+		return r.rt.RoundTrip(req)
+	}
+	o, ok := r.origins[number]
+	if !ok {
+		return r.rt.RoundTrip(req)
+	}
+	u, err := r.url(req.Context(), number, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.rt.RoundTrip(r.rewrite(req, o, u))
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		return resp, err
+	}
+	if u, err = r.url(req.Context(), number, true); err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return r.rt.RoundTrip(r.rewrite(req, o, u))
+}
+
+// rewrite returns req for the latest URL u of its segment. Requests for
+// another URL of the segment, such as its unmuted URL or the one of another
+// variant, keep their path and take the query of u holding the playback
+// token. A host differing from the original one, such as an alternate CDN
+// host, is kept.
+func (r *refresher) rewrite(req *http.Request, o origin, u *url.URL) *http.Request {
+	rewritten := new(http.Request)
+	*rewritten = *req
+	ru := *req.URL
+	if req.URL.Path == o.path {
+		ru = *u
+		if req.URL.Host != o.host {
+			ru.Host = req.URL.Host
+		}
+	} else {
+		ru.RawQuery = u.RawQuery
+	}
+	rewritten.URL = &ru
+	rewritten.Host = ""
+	return rewritten
+}
+
+// url returns the latest URL of the segment "number". The playlists are
+// fetched again if the token is about to expire or if force is set.
+func (r *refresher) url(ctx context.Context, number int, force bool) (*url.URL, error) {
+	// A failed proactive refresh is attempted again at the next segment
+	// while the current URLs may still be valid.
+	if err := r.refresh(ctx, force); err != nil && force {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.urls[number]
+	if !ok {
+		return nil, errors.Errorf("segment %d is missing from the playlist", number)
+	}
+	return u, nil
+}
+
+// refresh fetches the playlists again if the token is about to expire or if
+// force is set. Requests arriving during the fetch wait for it and share its
+// outcome, r.mu is not held meanwhile.
+func (r *refresher) refresh(ctx context.Context, force bool) error {
+	r.mu.Lock()
+	if f := r.flight; f != nil {
+		r.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	}
+	expiring := !r.expires.IsZero() && time.Until(r.expires) < refreshMargin
+	if force && !r.refreshed.IsZero() && time.Since(r.refreshed) < minRefreshInterval {
+		r.mu.Unlock()
+		return errors.New("playlists were refreshed recently")
+	}
+	if !force && !expiring {
+		r.mu.Unlock()
+		return nil
+	}
+	f := &flight{done: make(chan struct{})}
+	r.flight = f
+	r.mu.Unlock()
+
+	p, err := r.fetch(ctx)
+
+	r.mu.Lock()
+	if err == nil {
+		r.refreshed = time.Now()
+		r.expires = p.expires
+		for _, segment := range p.media.Segments {
+			if u, err := url.Parse(segment.URL); err == nil {
+				r.urls[segment.Number] = u
+			}
+		}
+	}
+	r.flight = nil
+	r.mu.Unlock()
+	f.err = err
+	close(f.done)
+	return err
+}
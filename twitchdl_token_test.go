@@ -0,0 +1,157 @@
+package twitchdl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jybp/twitch-downloader/m3u8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenTwitch serves a VOD of 3 segments whose URLs are only valid for the
+// latest playback token, expiring after expiry. The segments of muted are
+// listed with their "-muted.ts" URL.
+type tokenTwitch struct {
+	mu     sync.Mutex
+	tokens int
+	expiry func(token int) time.Duration
+	muted  map[int]bool
+}
+
+func (s *tokenTwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.URL.Path == "/gql":
+		s.tokens++
+		value := fmt.Sprintf(`{"expires":%d}`, time.Now().Add(s.expiry(s.tokens)).Unix())
+		fmt.Fprintf(w, `{"data":{"videoPlaybackAccessToken":{"value":%q,"signature":"sig"}}}`, value)
+	case r.URL.Path == "/vod/1":
+		fmt.Fprint(w, "#EXTM3U\n"+
+			"#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID=\"720p30\",NAME=\"720p30\",AUTOSELECT=YES,DEFAULT=YES\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720,VIDEO=\"720p30\"\n"+
+			"https://cdn.test/1/720p30/index-dvr.m3u8\n")
+	case strings.HasSuffix(r.URL.Path, ".m3u8"):
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n")
+		for i := 0; i < 3; i++ {
+			suffix := ""
+			if s.muted[i] {
+				suffix = "-muted"
+			}
+			fmt.Fprintf(w, "#EXTINF:10.000,\n%d%s.ts?token=%d\n", i, suffix, s.tokens)
+		}
+		fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+	case strings.HasSuffix(r.URL.Path, ".ts"):
+		if r.URL.Query().Get("token") != fmt.Sprint(s.tokens) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, "%s;", strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/1/720p30/"), ".ts"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	// The first token is about to expire.
+	s := &tokenTwitch{expiry: func(token int) time.Duration {
+		if token == 1 {
+			return time.Minute
+		}
+		return time.Hour
+	}}
+	client := testClient(t, s)
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30"})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "0;1;2;", string(b))
+	assert.Equal(t, 2, s.tokens)
+}
+
+func TestTokenRefreshForbidden(t *testing.T) {
+	s := &tokenTwitch{expiry: func(int) time.Duration { return time.Hour }}
+	client := testClient(t, s)
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30"})
+	require.NoError(t, err)
+	p := make([]byte, 2)
+	_, err = stream.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, "0;", string(p))
+
+	// The token is revoked in the middle of the download.
+	s.mu.Lock()
+	s.tokens++
+	s.mu.Unlock()
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1;2;", string(b))
+	assert.Equal(t, 3, s.tokens)
+}
+
+func TestTokenRefreshUnmuted(t *testing.T) {
+	s := &tokenTwitch{expiry: func(int) time.Duration { return time.Hour }, muted: map[int]bool{1: true}}
+	client := testClient(t, s)
+	stream, err := DownloadWithOptions(context.Background(), client, "", "https://www.twitch.tv/videos/1", Options{Quality: "720p30", Unmuted: true})
+	require.NoError(t, err)
+	p := make([]byte, 2)
+	_, err = stream.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, "0;", string(p))
+
+	// The unmuted URL of segment 1 is not in the playlist but carries the
+	// revoked token as well.
+	s.mu.Lock()
+	s.tokens++
+	s.mu.Unlock()
+	b, err := ioutil.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Equal(t, "1-unmuted;2;", string(b))
+	assert.Equal(t, 3, s.tokens)
+}
+
+func TestRefresherSingleFlight(t *testing.T) {
+	var fetches int32
+	started, release := make(chan struct{}), make(chan struct{})
+	fetch := func(ctx context.Context) (playlist, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return playlist{expires: time.Now().Add(time.Hour), media: m3u8.MediaPlaylist{Segments: []m3u8.MediaSegment{{Number: 0, URL: "https://cdn.test/0.ts?token=2"}}}}, nil
+	}
+	p := playlist{expires: time.Now(), refresh: fetch, media: m3u8.MediaPlaylist{Segments: []m3u8.MediaSegment{{Number: 0, URL: "https://cdn.test/0.ts?token=1"}}}}
+	r, err := newRefresher(p, nil)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	urls := make([]string, 2)
+	get := func(i int) {
+		defer wg.Done()
+		u, err := r.url(context.Background(), 0, false)
+		assert.NoError(t, err)
+		urls[i] = u.String()
+	}
+	wg.Add(1)
+	go get(0)
+	<-started
+	// The lock is not held during the fetch and the expiring token makes
+	// the second request wait for the ongoing refresh.
+	r.mu.Lock()
+	assert.NotNil(t, r.flight)
+	r.mu.Unlock()
+	wg.Add(1)
+	go get(1)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	assert.Equal(t, []string{"https://cdn.test/0.ts?token=2", "https://cdn.test/0.ts?token=2"}, urls)
+}
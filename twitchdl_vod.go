@@ -3,9 +3,12 @@ package twitchdl
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/jybp/twitch-downloader/m3u8"
@@ -13,18 +16,70 @@ import (
 	"github.com/pkg/errors"
 )
 
-func downloadVOD(ctx context.Context, client *http.Client, clientID, id, quality string, start, end time.Duration) (io.ReadCloser, error) {
-	api := twitch.New(client, clientID)
-	m3u8raw, err := api.M3U8(ctx, id)
+func downloadVOD(ctx context.Context, client *http.Client, clientID, id string, opts Options) (*Stream, error) {
+	p, err := fetchPlaylist(ctx, client, clientID, id, opts.Quality)
 	if err != nil {
 		return nil, err
 	}
-	master, err := m3u8.Master(bytes.NewReader(m3u8raw))
+	if len(opts.Chapter) > 0 {
+		chapters, err := VODChapters(ctx, client, clientID, id)
+		if err != nil {
+			return nil, err
+		}
+		matched := MatchChapters(chapters, opts.Chapter)
+		if len(matched) == 0 {
+			return nil, errors.Errorf("chapter %q not found", opts.Chapter)
+		}
+		opts.Ranges = ChapterRanges(matched)
+	}
+	return p.download(ctx, client, opts)
+}
+
+// download returns the Stream of the segments of p selected by the range or
+// the ranges of opts.
+func (p playlist) download(ctx context.Context, client *http.Client, opts Options) (*Stream, error) {
+	if len(opts.Ranges) > 0 {
+		return p.concat(ctx, client, opts)
+	}
+	start, end, err := ResolveRange(p.length(), opts.Start, opts.End, opts.Duration)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := sliceSegments(p.media.Segments, start, end)
 	if err != nil {
 		return nil, err
 	}
+	return p.stream(ctx, client, segments, opts, nil)
+}
+
+// playlist is the media playlist of the variant of a VOD being downloaded.
+type playlist struct {
+	quality string
+	master  m3u8.MasterPlaylist
+	variant m3u8.Variant
+	media   m3u8.MediaPlaylist
+	// expires is the expiry of the playback token, zero if unknown.
+	expires time.Time
+	// refresh fetches the playlists again with a new playback token.
+	refresh func(ctx context.Context) (playlist, error)
+}
+
+// fetchPlaylist fetches the media playlist of the VOD "id" at quality.
+func fetchPlaylist(ctx context.Context, client *http.Client, clientID, id, quality string) (playlist, error) {
+	api := twitch.New(client, clientID)
+	m3u8raw, expires, err := api.M3U8Expires(ctx, id)
+	if err != nil {
+		return playlist{}, err
+	}
+	master, err := m3u8.Master(bytes.NewReader(m3u8raw))
+	if err != nil {
+		return playlist{}, err
+	}
 
 	var variant m3u8.Variant
+	if quality == QualityBest && len(master.Variants) > 0 {
+		variant = master.Variants[0]
+	}
 L:
 	for _, v := range master.Variants {
 		for _, alt := range v.Alternatives {
@@ -37,34 +92,136 @@ L:
 	}
 
 	if len(variant.URL) == 0 {
-		return nil, errors.Errorf("quality %s not found", quality)
+		return playlist{}, errors.Errorf("quality %s not found", quality)
+	}
+
+	media, err := fetchMedia(ctx, client, variant.URL)
+	if err != nil {
+		return playlist{}, err
+	}
+	if len(variant.Alternatives) > 0 {
+		quality = variant.Alternatives[0].Name
+	}
+	refresh := func(ctx context.Context) (playlist, error) {
+		return fetchPlaylist(ctx, client, clientID, id, quality)
 	}
+	return playlist{quality: quality, master: master, variant: variant, media: media, expires: expires, refresh: refresh}, nil
+}
 
-	mediaResp, err := client.Get(variant.URL)
+// fetchMedia fetches the media playlist at mediaURL.
+func fetchMedia(ctx context.Context, client *http.Client, mediaURL string) (m3u8.MediaPlaylist, error) {
+	req, err := http.NewRequest(http.MethodGet, mediaURL, nil)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return m3u8.MediaPlaylist{}, errors.WithStack(err)
 	}
-	defer mediaResp.Body.Close()
-	media, err := m3u8.Media(mediaResp.Body, variant.URL)
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, err
+		return m3u8.MediaPlaylist{}, errors.WithStack(twitch.RedactError(err))
+	}
+	defer resp.Body.Close()
+	if s := resp.StatusCode; s < 200 || s >= 300 {
+		return m3u8.MediaPlaylist{}, errors.Errorf("%d: %s", s, twitch.RedactURL(mediaURL))
+	}
+	return m3u8.Media(resp.Body, mediaURL)
+}
+
+// length returns the duration of the VOD.
+func (p playlist) length() time.Duration {
+	var length time.Duration
+	for _, segment := range p.media.Segments {
+		length += segment.Duration
+	}
+	return length
+}
+
+// offset returns the position of the segment "number" in the VOD.
+func (p playlist) offset(number int) time.Duration {
+	var offset time.Duration
+	for _, segment := range p.media.Segments {
+		if segment.Number == number {
+			break
+		}
+		offset += segment.Duration
 	}
+	return offset
+}
 
+// stream returns the Stream of segments. Segments found in cache are
+// downloaded once for every stream sharing cache.
+func (p playlist) stream(ctx context.Context, client *http.Client, segments []m3u8.MediaSegment, opts Options, cache *segmentCache) (*Stream, error) {
+	if !p.expires.IsZero() && p.refresh != nil {
+		r, err := newRefresher(p, client.Transport)
+		if err != nil {
+			return nil, err
+		}
+		client = r.client(client)
+	}
 	var downloadFns []downloadFunc
-	segments, err := sliceSegments(media.Segments, start, end)
-	if err != nil {
-		return nil, err
+	var sizeFns []sizeFunc
+	var pool *hostPool
+	if len(opts.Hosts) > 0 && len(segments) > 0 {
+		u, err := url.Parse(segments[0].URL)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		pool = newHostPool(append([]string{u.Host}, opts.Hosts...))
 	}
-	for _, segment := range segments {
+	keys := newKeyCache()
+	recovered := &unmutedSegments{}
+	var pids *tsPIDs
+	if opts.GapFill == GapSkip {
+		pids = &tsPIDs{}
+	}
+	for i, segment := range segments {
 		req, err := http.NewRequest(http.MethodGet, segment.URL, nil)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		req = req.WithContext(ctx)
-		downloadFns = append(downloadFns, prepare(client, req))
+		req = req.WithContext(withSegment(ctx, segment.Number))
+		download, size := prepare(client, req), prepareSize(client, req)
+		if pool != nil {
+			download, size = pool.prepare(client, req), pool.prepareSize(client, req)
+		}
+		if opts.Unmuted && segment.Muted {
+			download, size, err = unmuted(ctx, client, segment, i, len(segments), download, size, opts.Events, recovered)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if download, size, err = keys.decrypt(ctx, client, segment, download, size); err != nil {
+			return nil, err
+		}
+		if cache != nil {
+			download = cache.wrap(segment.Number, download)
+		}
+		if pids != nil {
+			download = pids.wrap(download)
+		}
+		downloadFns = append(downloadFns, download)
+		sizeFns = append(sizeFns, size)
 	}
 
-	return &merger{downloads: downloadFns}, nil
+	g := &gaps{}
+	fill, err := p.filler(ctx, client, segments, opts, g, keys, pids)
+	if err != nil {
+		return nil, err
+	}
+
+	variant := p.variant
+	info := Info{Quality: p.quality, Variant: &variant, Segments: segments, Muted: p.mutedRanges(segments, nil)}
+	if n := len(segments); n > 0 {
+		info.Start = p.offset(segments[0].Number)
+		info.End = p.offset(segments[n-1].Number) + segments[n-1].Duration
+	}
+	m := &merger{ctx: ctx, downloads: downloadFns, sizes: sizeFns, skip: opts.Resume, retries: opts.Retries, delay: opts.RetryDelay, events: opts.Events, fill: fill, limiter: opts.Limiter}
+	if cache != nil {
+		m.skipped = func(index int) { cache.release(segments[index].Number) }
+	}
+	stream := &Stream{ReadCloser: m, info: info, gaps: g, hosts: pool}
+	if opts.Unmuted {
+		stream.muted = func() []Range { return p.mutedRanges(segments, recovered) }
+	}
+	return stream, nil
 }
 
 func sliceSegments(segments []m3u8.MediaSegment, start, end time.Duration) ([]m3u8.MediaSegment, error) {
@@ -111,50 +268,241 @@ func prepare(client *http.Client, req *http.Request) downloadFunc {
 	return func() (io.ReadCloser, error) {
 		resp, err := client.Do(req)
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, errors.WithStack(twitch.RedactError(err))
 		}
 		if s := resp.StatusCode; s < 200 || s >= 300 {
-			return nil, errors.Errorf("%d: %s", s, req.URL)
+			resp.Body.Close()
+			return nil, errors.WithStack(&statusError{code: s, url: req.URL.String()})
 		}
 		return resp.Body, nil
 	}
 }
 
+// statusError is the error of a request answered with an unexpected status.
+type statusError struct {
+	code int
+	url  string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d: %s", e.code, twitch.RedactURL(e.url))
+}
+
+// sizeFunc describes a func that returns the size of the body of a request.
+type sizeFunc func() (int64, error)
+
+func prepareSize(client *http.Client, req *http.Request) sizeFunc {
+	return func() (int64, error) {
+		head, err := http.NewRequest(http.MethodHead, req.URL.String(), nil)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		resp, err := client.Do(head.WithContext(req.Context()))
+		if err != nil {
+			return 0, errors.WithStack(twitch.RedactError(err))
+		}
+		resp.Body.Close()
+		if s := resp.StatusCode; s < 200 || s >= 300 {
+			return 0, errors.WithStack(&statusError{code: s, url: req.URL.String()})
+		}
+		if resp.ContentLength < 0 {
+			return 0, errors.Errorf("unknown size: %s", twitch.RedactURL(req.URL.String()))
+		}
+		return resp.ContentLength, nil
+	}
+}
+
 // merger merges the several downloadFunc into a single io.Reader.
 type merger struct {
+	// ctx, when not nil, cancels the waits between retries.
+	ctx       context.Context
 	downloads []downloadFunc
+	// sizes, when not nil, holds the size of each download. Downloads
+	// entirely skipped are not performed.
+	sizes []sizeFunc
+	// skip is the number of bytes left to skip.
+	skip int64
+	// skipped, when not nil, is called with the index of each download
+	// entirely skipped.
+	skipped func(index int)
+	retries int
+	delay   time.Duration
+	events  func(Event)
+	// boundary, when not nil, is called before downloading each segment.
+	// If it returns true, Read returns io.EOF until paused is reset.
+	boundary func(index int) bool
+	paused   bool
+	// fill, when not nil, is called with the index of a download failing
+	// after every retry. It returns the content replacing the download.
+	fill func(index int, err error) (io.ReadCloser, error)
+	// limiter, when not nil, caps the bandwidth of the downloads.
+	limiter *Limiter
 
 	index   int
 	current io.ReadCloser
+	n       int64
 	err     error
+	// attempts is the number of retries of the current download, retrying
+	// is set when it is downloaded again after a failed read.
+	attempts int
+	retrying bool
 }
 
+// retryDelay is the default delay before the first retry.
+var retryDelay = time.Second
+
 func (r *merger) next() error {
+	for r.skip > 0 && r.index < len(r.sizes) {
+		n, err := r.sizes[r.index]()
+		if err != nil || n > r.skip {
+			break
+		}
+		r.skip -= n
+		if r.skipped != nil {
+			r.skipped(r.index)
+		}
+		r.index++
+	}
 	if r.index >= len(r.downloads) {
 		r.current = nil
 		r.index++
 		return nil
 	}
+	if !r.retrying {
+		r.attempts = 0
+	}
+	r.retrying = false
 	var err error
-	r.current, err = r.downloads[r.index]()
+	for ; ; r.attempts++ {
+		var body io.ReadCloser
+		body, err = r.downloads[r.index]()
+		if err == nil {
+			r.use(body)
+			break
+		}
+		if r.attempts >= r.retries {
+			break
+		}
+		if err := r.wait(err); err != nil {
+			return err
+		}
+	}
+	if err != nil && r.fill != nil {
+		var body io.ReadCloser
+		if body, err = r.fill(r.index, err); err == nil {
+			r.use(body)
+		}
+	}
+	r.n = 0
 	r.index++
 	return err
 }
 
+// use makes body the current download.
+func (r *merger) use(body io.ReadCloser) {
+	r.current = body
+	if r.limiter != nil {
+		r.current = &limitReader{ReadCloser: body, l: r.limiter, ctx: r.ctx}
+	}
+}
+
+// wait emits the retry of the download at r.index failing with err and
+// waits before it. The delay doubles at each attempt.
+func (r *merger) wait(err error) error {
+	r.emit(Event{Type: EventRetry, Segment: r.index, Segments: len(r.downloads), Attempt: r.attempts + 1, Err: err})
+	delay := r.delay
+	if delay <= 0 {
+		delay = retryDelay
+	}
+	for i := 0; i < r.attempts; i++ {
+		delay *= 2
+	}
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	case <-t.C:
+		return nil
+	}
+}
+
+// failed handles the current download failing with err before any of its
+// bytes was read: it is downloaded again, or filled once out of retries.
+func (r *merger) failed(err error) error {
+	r.current.Close()
+	r.current = nil
+	r.index--
+	if r.attempts < r.retries {
+		if err := r.wait(err); err != nil {
+			return err
+		}
+		r.attempts++
+		r.retrying = true
+		return nil
+	}
+	if r.fill == nil {
+		return errors.WithStack(err)
+	}
+	body, err := r.fill(r.index, err)
+	if err != nil {
+		return err
+	}
+	r.use(body)
+	r.index++
+	return nil
+}
+
+func (r *merger) emit(e Event) {
+	if r.events != nil {
+		r.events(e)
+	}
+}
+
 // Read allows merger to implement io.Reader.
 func (r *merger) Read(p []byte) (int, error) {
 	for {
 		if r.err != nil {
 			return 0, r.err
 		}
+		if r.current != nil && r.skip > 0 {
+			n, err := io.CopyN(ioutil.Discard, r.current, r.skip)
+			r.skip -= n
+			r.n += n
+			if err == io.EOF {
+				err = r.current.Close()
+				r.current = nil
+				r.emit(Event{Type: EventSegment, Segment: r.index - 1, Segments: len(r.downloads), Bytes: r.n})
+			}
+			if err != nil {
+				return 0, errors.WithStack(err)
+			}
+			continue
+		}
 		if r.current != nil {
 			n, err := r.current.Read(p)
+			r.n += int64(n)
+			if err != nil && err != io.EOF && r.n == 0 {
+				if err := r.failed(err); err != nil {
+					return 0, err
+				}
+				continue
+			}
 			if err == io.EOF {
 				err = r.current.Close()
 				r.current = nil
+				r.emit(Event{Type: EventSegment, Segment: r.index - 1, Segments: len(r.downloads), Bytes: r.n})
 			}
 			return n, errors.WithStack(err)
 		}
+		if r.boundary != nil && r.index < len(r.downloads) && (r.paused || r.boundary(r.index)) {
+			r.paused = true
+			return 0, io.EOF
+		}
 		if err := r.next(); err != nil {
 			return 0, err
 		}